@@ -0,0 +1,127 @@
+// Package address converts Bitcoin output scripts to addresses and back:
+// base58check for P2PKH and P2SH, bech32 for segwit version 0 programs.
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Params are the address prefixes of a coin.
+type Params struct {
+	Coin       string
+	PubKeyHash byte
+	ScriptHash byte
+	HRP        string
+}
+
+var (
+	Bitcoin = Params{Coin: "Bitcoin", PubKeyHash: 0x00, ScriptHash: 0x05, HRP: "bc"}
+	Testnet = Params{Coin: "Testnet", PubKeyHash: 0x6f, ScriptHash: 0xc4, HRP: "tb"}
+)
+
+// ByCoin returns the params of a coin by the name the device uses for it.
+func ByCoin(coin string) (Params, bool) {
+	for _, p := range []Params{Bitcoin, Testnet} {
+		if p.Coin == coin {
+			return p, true
+		}
+	}
+	return Params{}, false
+}
+
+// ErrUnknownScript is returned for scripts that have no address.
+var ErrUnknownScript = errors.New("address: script has no address")
+
+// FromScript returns the address paying to an output script.
+func FromScript(script []byte, p Params) (string, error) {
+	switch {
+	case IsP2PKH(script):
+		return CheckEncode(append([]byte{p.PubKeyHash}, script[3:23]...)), nil
+	case IsP2SH(script):
+		return CheckEncode(append([]byte{p.ScriptHash}, script[2:22]...)), nil
+	case IsP2WPKH(script) || IsP2WSH(script):
+		return SegwitEncode(p.HRP, 0, script[2:])
+	}
+	return "", ErrUnknownScript
+}
+
+// ToScript returns the output script paying to an address.
+func ToScript(addr string, p Params) ([]byte, error) {
+	if version, program, err := SegwitDecode(p.HRP, addr); err == nil {
+		if version != 0 {
+			return nil, fmt.Errorf("address: unsupported witness version %d", version)
+		}
+		return append([]byte{0x00, byte(len(program))}, program...), nil
+	}
+	payload, err := CheckDecode(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 21 {
+		return nil, fmt.Errorf("address: invalid length %d", len(payload))
+	}
+	switch payload[0] {
+	case p.PubKeyHash:
+		return P2PKH(payload[1:]), nil
+	case p.ScriptHash:
+		return P2SH(payload[1:]), nil
+	}
+	return nil, fmt.Errorf("address: unknown version %d for %s", payload[0], p.Coin)
+}
+
+// P2PKH returns the script paying to a public key hash.
+func P2PKH(hash []byte) []byte {
+	script := append([]byte{0x76, 0xa9, 0x14}, hash...)
+	return append(script, 0x88, 0xac)
+}
+
+// P2SH returns the script paying to a script hash.
+func P2SH(hash []byte) []byte {
+	script := append([]byte{0xa9, 0x14}, hash...)
+	return append(script, 0x87)
+}
+
+// P2WPKH returns the script paying to a witness public key hash.
+func P2WPKH(hash []byte) []byte {
+	return append([]byte{0x00, 0x14}, hash...)
+}
+
+// P2WSH returns the script paying to a witness script hash.
+func P2WSH(hash []byte) []byte {
+	return append([]byte{0x00, 0x20}, hash...)
+}
+
+// Hash160 returns RIPEMD160(SHA256(b)), the hash of public keys and
+// scripts in addresses.
+func Hash160(b []byte) []byte {
+	sha := sha256.Sum256(b)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+func IsP2PKH(script []byte) bool {
+	return len(script) == 25 && bytes.HasPrefix(script, []byte{0x76, 0xa9, 0x14}) && bytes.HasSuffix(script, []byte{0x88, 0xac})
+}
+
+func IsP2SH(script []byte) bool {
+	return len(script) == 23 && bytes.HasPrefix(script, []byte{0xa9, 0x14}) && script[22] == 0x87
+}
+
+func IsP2WPKH(script []byte) bool {
+	return len(script) == 22 && script[0] == 0x00 && script[1] == 0x14
+}
+
+func IsP2WSH(script []byte) bool {
+	return len(script) == 34 && script[0] == 0x00 && script[1] == 0x20
+}
+
+// IsOpReturn reports whether script is a data carrier output.
+func IsOpReturn(script []byte) bool {
+	return len(script) > 0 && script[0] == 0x6a
+}
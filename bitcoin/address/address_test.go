@@ -0,0 +1,59 @@
+package address
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestScripts(t *testing.T) {
+	for _, v := range []struct {
+		params Params
+		addr   string
+		script string
+	}{
+		{Bitcoin, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{Bitcoin, "3CNHUhP3uyB9EUtRLsmvFUmvGdjGdkTxJw", "a914751e76e8199196d454941c45d1b3a323f1433bd687"},
+		// BIP-173 test vectors
+		{Bitcoin, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Testnet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+	} {
+		script, _ := hex.DecodeString(v.script)
+		addr, err := FromScript(script, v.params)
+		if err != nil || addr != v.addr {
+			t.Errorf("%s: unexpected address %q %v", v.script, addr, err)
+		}
+		back, err := ToScript(v.addr, v.params)
+		if err != nil || hex.EncodeToString(back) != v.script {
+			t.Errorf("%s: unexpected script %x %v", v.addr, back, err)
+		}
+	}
+}
+
+func TestHash160(t *testing.T) {
+	// the public key of the private key 1, hashed in the vectors above
+	pubKey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	if h := hex.EncodeToString(Hash160(pubKey)); h != "751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Errorf("unexpected hash %s", h)
+	}
+	if hex.EncodeToString(P2WPKH(Hash160(pubKey))) != "0014751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Error("unexpected P2WPKH script")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, addr := range []string{
+		"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMJ",           // checksum
+		"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",           // testnet address
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",   // checksum
+		"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8f3t4",   // mixed case
+		"bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du",        // version 2
+		"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdc", // other network
+	} {
+		if script, err := ToScript(addr, Bitcoin); err == nil {
+			t.Errorf("%s: expected an error, received %x", addr, script)
+		}
+	}
+	if _, err := FromScript([]byte{0x6a, 0x01, 0x00}, Bitcoin); err != ErrUnknownScript {
+		t.Errorf("expected ErrUnknownScript, received %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	// ErrChecksum is returned when a base58check string has a wrong checksum.
+	ErrChecksum = errors.New("address: bad checksum")
+	// ErrBase58 is returned for strings with characters outside the alphabet.
+	ErrBase58 = errors.New("address: invalid base58 character")
+)
+
+// Base58Encode encodes b without checksum, keeping its leading zeros as '1'.
+func Base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Base58Decode decodes a string encoded with Base58Encode.
+func Base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, ErrBase58
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// CheckEncode encodes payload, version bytes included, with the 4-byte
+// double SHA-256 checksum appended.
+func CheckEncode(payload []byte) string {
+	sum := checksum(payload)
+	return Base58Encode(append(append([]byte{}, payload...), sum[:]...))
+}
+
+// CheckDecode decodes a base58check string and verifies its checksum.
+func CheckDecode(s string) ([]byte, error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, ErrChecksum
+	}
+	payload := b[:len(b)-4]
+	if sum := checksum(payload); !bytes.Equal(sum[:], b[len(b)-4:]) {
+		return nil, ErrChecksum
+	}
+	return payload, nil
+}
+
+func checksum(b []byte) [4]byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	var sum [4]byte
+	copy(sum[:], second[:4])
+	return sum
+}
@@ -0,0 +1,122 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// ErrBech32 is returned for malformed bech32 addresses.
+var ErrBech32 = errors.New("address: invalid bech32 address")
+
+// SegwitEncode encodes a witness program as a BIP-173 address.
+func SegwitEncode(hrp string, version byte, program []byte) (string, error) {
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return "", ErrBech32
+	}
+	data := append([]byte{version}, convertBits(program, 8, 5, true)...)
+	values := append(data, bech32Checksum(hrp, data)...)
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String(), nil
+}
+
+// SegwitDecode decodes a BIP-173 address with the human readable part hrp.
+func SegwitDecode(hrp, addr string) (byte, []byte, error) {
+	if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return 0, nil, ErrBech32
+	}
+	addr = strings.ToLower(addr)
+	sep := strings.LastIndexByte(addr, '1')
+	if sep < 1 || sep+7 > len(addr) || len(addr) > 90 || addr[:sep] != hrp {
+		return 0, nil, ErrBech32
+	}
+	values := make([]byte, 0, len(addr)-sep-1)
+	for _, c := range addr[sep+1:] {
+		i := strings.IndexRune(bech32Charset, c)
+		if i < 0 {
+			return 0, nil, ErrBech32
+		}
+		values = append(values, byte(i))
+	}
+	if bech32Polymod(append(hrpExpand(hrp), values...)) != 1 {
+		return 0, nil, ErrChecksum
+	}
+	data := values[:len(values)-6]
+	if len(data) < 1 || data[0] > 16 {
+		return 0, nil, ErrBech32
+	}
+	program := convertBits(data[1:], 5, 8, false)
+	if program == nil || len(program) < 2 || len(program) > 40 || (data[0] == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, fmt.Errorf("%w: program length %d", ErrBech32, len(program))
+	}
+	return data[0], program, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(hrpExpand(hrp), data...)
+	mod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+	sum := make([]byte, 6)
+	for i := range sum {
+		sum[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return sum
+}
+
+// convertBits regroups data from fromBits to toBits wide values, it returns
+// nil when padding is not allowed and the input does not fit exactly.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	out := []byte{}
+	for _, v := range data {
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+// Package script holds the kinds of single key scripts the device spends and
+// pays change to, and the script_type fields they map to.
+package script
+
+import "github.com/conejoninja/cerrojo/pb/types"
+
+// Type is the kind of single key script an input spends or a change output
+// pays to.
+type Type int
+
+const (
+	// P2PKH is a legacy pay to public key hash script, BIP-44 accounts.
+	P2PKH Type = iota
+	// P2SHP2WPKH is a P2WPKH script nested in P2SH, BIP-49 accounts.
+	P2SHP2WPKH
+	// P2WPKH is a native segwit pay to witness public key hash script,
+	// BIP-84 accounts.
+	P2WPKH
+)
+
+const hardened = 0x80000000
+
+// ForPath returns the script type of the account path belongs to from its
+// BIP-44, BIP-49 or BIP-84 purpose, P2PKH for other paths.
+func ForPath(path []uint32) Type {
+	if len(path) > 0 {
+		switch path[0] {
+		case hardened + 49:
+			return P2SHP2WPKH
+		case hardened + 84:
+			return P2WPKH
+		}
+	}
+	return P2PKH
+}
+
+// InputScriptType returns the script_type of inputs spending s.
+func (s Type) InputScriptType() types.InputScriptType {
+	switch s {
+	case P2SHP2WPKH:
+		return types.InputScriptType_SPENDP2SHWITNESS
+	case P2WPKH:
+		return types.InputScriptType_SPENDWITNESS
+	}
+	return types.InputScriptType_SPENDADDRESS
+}
+
+// OutputScriptType returns the script_type of change outputs paying to s.
+func (s Type) OutputScriptType() types.OutputScriptType {
+	switch s {
+	case P2SHP2WPKH:
+		return types.OutputScriptType_PAYTOP2SHWITNESS
+	case P2WPKH:
+		return types.OutputScriptType_PAYTOWITNESS
+	}
+	return types.OutputScriptType_PAYTOADDRESS
+}
@@ -0,0 +1,313 @@
+// Package tx parses and serializes raw Bitcoin transactions, legacy and
+// segwit, and converts them to the shape devices expect for the previous
+// transactions of a SignTx exchange.
+package tx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// Tx is a Bitcoin transaction.
+type Tx struct {
+	Version  uint32
+	Inputs   []Input
+	Outputs  []Output
+	LockTime uint32
+}
+
+// Input spends the output PrevIndex of the transaction PrevHash. PrevHash is
+// in display order, as txids and the prev_hash of the device messages, the
+// reverse of the order used on the wire.
+type Input struct {
+	PrevHash  []byte
+	PrevIndex uint32
+	ScriptSig []byte
+	Sequence  uint32
+	Witness   [][]byte
+}
+
+type Output struct {
+	Amount uint64
+	Script []byte
+}
+
+var (
+	// ErrNonCanonical is returned for variable length integers that are not
+	// minimally encoded, which the network refuses.
+	ErrNonCanonical = errors.New("tx: non-canonical variable length integer")
+	// ErrTrailingData is returned when bytes are left after the lock time.
+	ErrTrailingData = errors.New("tx: trailing data")
+	// ErrEmptyWitness is returned for a segwit serialization without any
+	// witness, which the network refuses.
+	ErrEmptyWitness = errors.New("tx: segwit marker without witness")
+)
+
+// Parse decodes a raw transaction in either serialization.
+func Parse(raw []byte) (*Tx, error) {
+	return parse(raw, true)
+}
+
+// ParseLegacy decodes a raw transaction that cannot have witnesses, like the
+// unsigned transaction of a PSBT. A transaction without inputs would
+// otherwise read as a segwit marker.
+func ParseLegacy(raw []byte) (*Tx, error) {
+	return parse(raw, false)
+}
+
+func parse(raw []byte, witness bool) (*Tx, error) {
+	r := bytes.NewReader(raw)
+	tx := &Tx{}
+
+	if err := binary.Read(r, binary.LittleEndian, &tx.Version); err != nil {
+		return nil, err
+	}
+	segwit := witness && len(raw) > 6 && raw[4] == 0 && raw[5] == 1
+	if segwit {
+		r.Seek(2, io.SeekCurrent)
+	}
+
+	count, err := ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	// an input takes at least 41 bytes, do not trust counts beyond that
+	if count > uint64(r.Len()/41) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	tx.Inputs = make([]Input, count)
+	for i := range tx.Inputs {
+		in := &tx.Inputs[i]
+		prevHash := make([]byte, 32)
+		if _, err = io.ReadFull(r, prevHash); err != nil {
+			return nil, err
+		}
+		in.PrevHash = reverse(prevHash)
+		if err = binary.Read(r, binary.LittleEndian, &in.PrevIndex); err != nil {
+			return nil, err
+		}
+		if in.ScriptSig, err = ReadVarBytes(r); err != nil {
+			return nil, err
+		}
+		if err = binary.Read(r, binary.LittleEndian, &in.Sequence); err != nil {
+			return nil, err
+		}
+	}
+
+	if count, err = ReadVarInt(r); err != nil {
+		return nil, err
+	}
+	if count > uint64(r.Len()/9) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	tx.Outputs = make([]Output, count)
+	for i := range tx.Outputs {
+		out := &tx.Outputs[i]
+		if err = binary.Read(r, binary.LittleEndian, &out.Amount); err != nil {
+			return nil, err
+		}
+		if out.Script, err = ReadVarBytes(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if segwit {
+		for i := range tx.Inputs {
+			items, err := ReadVarInt(r)
+			if err != nil {
+				return nil, err
+			}
+			if items > uint64(r.Len()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			witness := make([][]byte, items)
+			for j := range witness {
+				if witness[j], err = ReadVarBytes(r); err != nil {
+					return nil, err
+				}
+			}
+			if items > 0 {
+				tx.Inputs[i].Witness = witness
+			}
+		}
+		if !tx.HasWitness() {
+			return nil, ErrEmptyWitness
+		}
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &tx.LockTime); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return tx, nil
+}
+
+// HasWitness reports whether any input has witness data, which makes
+// Serialize use the segwit serialization.
+func (tx *Tx) HasWitness() bool {
+	for _, in := range tx.Inputs {
+		if len(in.Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Serialize encodes the transaction, with its witnesses if it has any.
+func (tx *Tx) Serialize() []byte {
+	return tx.serialize(tx.HasWitness())
+}
+
+// SerializeLegacy encodes the transaction without its witnesses, the
+// serialization its txid is computed from.
+func (tx *Tx) SerializeLegacy() []byte {
+	return tx.serialize(false)
+}
+
+func (tx *Tx) serialize(witness bool) []byte {
+	w := &bytes.Buffer{}
+	binary.Write(w, binary.LittleEndian, tx.Version)
+	if witness {
+		w.Write([]byte{0x00, 0x01})
+	}
+	WriteVarInt(w, uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		w.Write(reverse(in.PrevHash))
+		binary.Write(w, binary.LittleEndian, in.PrevIndex)
+		WriteVarBytes(w, in.ScriptSig)
+		binary.Write(w, binary.LittleEndian, in.Sequence)
+	}
+	WriteVarInt(w, uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		binary.Write(w, binary.LittleEndian, out.Amount)
+		WriteVarBytes(w, out.Script)
+	}
+	if witness {
+		for _, in := range tx.Inputs {
+			WriteVarInt(w, uint64(len(in.Witness)))
+			for _, item := range in.Witness {
+				WriteVarBytes(w, item)
+			}
+		}
+	}
+	binary.Write(w, binary.LittleEndian, tx.LockTime)
+	return w.Bytes()
+}
+
+// Hash returns the transaction hash in display order.
+func (tx *Tx) Hash() []byte {
+	first := sha256.Sum256(tx.SerializeLegacy())
+	second := sha256.Sum256(first[:])
+	return reverse(second[:])
+}
+
+// TxID returns the transaction hash in hex, as shown by block explorers.
+func (tx *Tx) TxID() string {
+	return hex.EncodeToString(tx.Hash())
+}
+
+// Transaction converts the transaction to the shape devices expect when
+// they ask for a previous transaction: inputs, bin_outputs, version and
+// lock_time, built with the Typer of the device profile.
+func (tx *Tx) Transaction(tp types.Typer) types.TransactionTyper {
+	version, lockTime := tx.Version, tx.LockTime
+	t := tp.GetTransactionType()
+	t.SetVersion(&version)
+	t.SetLockTime(&lockTime)
+	for i := range tx.Inputs {
+		prevIndex, sequence := tx.Inputs[i].PrevIndex, tx.Inputs[i].Sequence
+		input := tp.GetTxInputType()
+		input.SetPrevHash(tx.Inputs[i].PrevHash)
+		input.SetPrevIndex(&prevIndex)
+		input.SetScriptSig(tx.Inputs[i].ScriptSig)
+		input.SetSequence(&sequence)
+		types.SetMessages(t, "inputs", input)
+	}
+	for i := range tx.Outputs {
+		amount := tx.Outputs[i].Amount
+		output := tp.GetTxOutputBinType()
+		output.SetAmount(&amount)
+		output.SetScriptPubkey(tx.Outputs[i].Script)
+		types.SetMessages(t, "bin_outputs", output)
+	}
+	return t
+}
+
+// ReadVarInt reads a variable length integer, as used for counts and
+// lengths in transactions and PSBTs.
+func ReadVarInt(r io.Reader) (uint64, error) {
+	var prefix [1]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, err
+	}
+	size := map[byte]int{0xfd: 2, 0xfe: 4, 0xff: 8}[prefix[0]]
+	if size == 0 {
+		return uint64(prefix[0]), nil
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return 0, err
+	}
+	n := binary.LittleEndian.Uint64(buf)
+	if n < map[int]uint64{2: 0xfd, 4: 0x10000, 8: 0x100000000}[size] {
+		return 0, ErrNonCanonical
+	}
+	return n, nil
+}
+
+// ReadVarBytes reads a byte string prefixed with its length.
+func ReadVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return b, nil
+}
+
+// WriteVarInt writes n as a variable length integer.
+func WriteVarInt(w io.Writer, n uint64) {
+	buf := make([]byte, 9)
+	switch {
+	case n < 0xfd:
+		w.Write([]byte{byte(n)})
+	case n <= 0xffff:
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(n))
+		w.Write(buf[:3])
+	case n <= 0xffffffff:
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(n))
+		w.Write(buf[:5])
+	default:
+		buf[0] = 0xff
+		binary.LittleEndian.PutUint64(buf[1:], n)
+		w.Write(buf)
+	}
+}
+
+// WriteVarBytes writes b prefixed with its length.
+func WriteVarBytes(w io.Writer, b []byte) {
+	WriteVarInt(w, uint64(len(b)))
+	w.Write(b)
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,104 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	keepkeytypes "github.com/conejoninja/cerrojo/pb/keepkey/types"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// segwitTx spends two P2SH-P2WPKH outputs, legacyTx spends its first output.
+// Both come from the BIP-174 test vectors.
+var (
+	segwitTx = "0100000000010289a3c71eab4d20e0371bbba4cc698fa295c9463afa2e397f8533ccb62f9567e50100000017160014be18d152a9b012039daf3da7de4f53349eecb985ffffffff86f8aa43a71dff1448893a530a7237ef6b4608bbb2dd2d0171e63aec6a4890b40100000017160014fe3e9ef1a745e974d902c4355943abcb34bd5353ffffffff0200c2eb0b000000001976a91485cff1097fd9e008bb34af709c62197b38978a4888ac72fef84e2c00000017a914339725ba21efd62ac753a9bcd067d6c7a6a39d05870247304402202712be22e0270f394f568311dc7ca9a68970b8025fdd3b240229f07f8a5f3a240220018b38d7dcd314e734c9276bd6fb40f673325bc4baa144c800d2f2f02db2765c012103d2e15674941bad4a996372cb87e1856d3652606d98562fe39c5e9e7e413f210502483045022100d12b852d85dcd961d2f5f4ab660654df6eedcc794c0c33ce5cc309ffb5fce58d022067338a8e0e1725c197fb1a88af59f51e44e4255b20167c8684031c05d1f2592a01210223b72beef0965d10be0778efecd61fcac6f79a4ea169393380734464f84f2ab300000000"
+	legacyTx = "0200000001268171371edff285e937adeea4b37b78000c0566cbb3ad64641713ca42171bf6000000006a473044022070b2245123e6bf474d60c5b50c043d4c691a5d2435f09a34a7662a9dc251790a022001329ca9dacf280bdf30740ec0390422422c81cb45839457aeb76fc12edd95b3012102657d118d3357b8e0f4c2cd46db7b39f6d9c38d9a70abcb9b2de5dc8dbfe4ce31feffffff02d3dff505000000001976a914d0c59903c5bac2868760e90fd521a4665aa7652088ac00e1f5050000000017a9143545e6e33b832c47050f24d3eeb93c9c03948bc787b32e1300"
+)
+
+func TestParse(t *testing.T) {
+	for _, v := range []struct {
+		raw     string
+		txid    string
+		witness bool
+		inputs  int
+		outputs int
+	}{
+		{segwitTx, "f61b1742ca13176464adb3cb66050c00787bb3a4eead37e985f2df1e37718126", true, 2, 2},
+		{legacyTx, "e47b5b7a879f13a8213815cf3dc3f5b35af1e217f412829bc4f75a8ca04909ab", false, 1, 2},
+	} {
+		raw, _ := hex.DecodeString(v.raw)
+		tx, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", v.txid, err)
+		}
+		if tx.TxID() != v.txid || tx.HasWitness() != v.witness || len(tx.Inputs) != v.inputs || len(tx.Outputs) != v.outputs {
+			t.Errorf("%s: unexpected transaction %s %+v", v.txid, tx.TxID(), tx)
+		}
+		if !bytes.Equal(tx.Serialize(), raw) {
+			t.Errorf("%s: serialized differently\n%x", v.txid, tx.Serialize())
+		}
+	}
+
+	segwit, _ := hex.DecodeString(segwitTx)
+	legacy, _ := hex.DecodeString(legacyTx)
+	spending, _ := Parse(legacy)
+	spent, _ := Parse(segwit)
+	if !bytes.Equal(spending.Inputs[0].PrevHash, spent.Hash()) {
+		t.Errorf("expected the previous hash in display order, received %x", spending.Inputs[0].PrevHash)
+	}
+	if stripped := spent.SerializeLegacy(); stripped[4] == 0 || bytes.Contains(stripped, spent.Inputs[0].Witness[0]) {
+		t.Error("expected the legacy serialization to drop the witnesses")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	legacy, _ := hex.DecodeString(legacyTx)
+	nonCanonical := append([]byte{}, legacy[:4]...)
+	nonCanonical = append(append(nonCanonical, 0xfd, 0x01, 0x00), legacy[5:]...)
+
+	for name, raw := range map[string][]byte{
+		"truncated":     legacy[:len(legacy)-1],
+		"trailing":      append(append([]byte{}, legacy...), 0),
+		"non-canonical": nonCanonical,
+		"empty witness": append([]byte{1, 0, 0, 0, 0, 1}, legacy[4:]...),
+		"huge count":    {1, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// a transaction without inputs reads as a segwit marker unless witnesses
+	// are ruled out
+	empty, _ := hex.DecodeString("01000000000100000000000000000d6a0b68656c6c6f20776f726c6400000000")
+	tx, err := ParseLegacy(empty)
+	if err != nil || len(tx.Inputs) != 0 || len(tx.Outputs) != 1 || !bytes.Equal(tx.Serialize(), empty) {
+		t.Errorf("unexpected transaction %+v %v", tx, err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	raw, _ := hex.DecodeString(segwitTx)
+	tx, _ := Parse(raw)
+	for name, tp := range map[string]types.Typer{
+		"trezor":  &trezortypes.Getter{},
+		"keepkey": &keepkeytypes.Getter{},
+	} {
+		prev := tx.Transaction(tp)
+		if prev.GetVersion() != tx.Version || prev.GetLockTime() != tx.LockTime || len(prev.GetInputs()) != 2 || len(prev.GetBinOutputs()) != 2 {
+			t.Errorf("%s: unexpected transaction %v", name, prev)
+			continue
+		}
+		in := prev.GetInputs()[1]
+		if !bytes.Equal(in.GetPrevHash(), tx.Inputs[1].PrevHash) || in.GetPrevIndex() != tx.Inputs[1].PrevIndex ||
+			in.GetSequence() != tx.Inputs[1].Sequence || !bytes.Equal(in.GetScriptSig(), tx.Inputs[1].ScriptSig) {
+			t.Errorf("%s: unexpected input %v", name, in)
+		}
+		out := prev.GetBinOutputs()[0]
+		if out.GetAmount() != tx.Outputs[0].Amount || !bytes.Equal(out.GetScriptPubkey(), tx.Outputs[0].Script) {
+			t.Errorf("%s: unexpected output %v", name, out)
+		}
+	}
+}
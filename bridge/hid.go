@@ -0,0 +1,25 @@
+package bridge
+
+import (
+	"encoding/hex"
+
+	"github.com/conejoninja/cerrojo"
+)
+
+// USBDevices lists the connected HID and WebUSB devices matching any profile
+// in the devices registry. Their path is the OS device path, hex encoded as
+// it may contain slashes, so it stays the same while the device is plugged
+// whatever comes and goes on the other ports.
+func USBDevices() []Device {
+	var devs []Device
+	for _, d := range cerrojo.Enumerate() {
+		devs = append(devs, Device{
+			Path:    hex.EncodeToString([]byte(d.Path)),
+			Vendor:  d.VendorID,
+			Product: d.ProductID,
+			Profile: d.Profile,
+			Open:    d.Transport,
+		})
+	}
+	return devs
+}
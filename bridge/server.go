@@ -0,0 +1,334 @@
+// Package bridge serves cerrojo-connected devices over the trezord HTTP API,
+// so browser and desktop wallets can use them as if the official bridge was
+// running.
+package bridge
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/transport"
+)
+
+// Version is reported on the / endpoint.
+const Version = "2.0.27"
+
+// DefaultOrigins are the origins allowed to talk to the server, as
+// path.Match patterns.
+var DefaultOrigins = []string{
+	"https://*.trezor.io",
+	"https://trezor.io",
+	"http://localhost:*",
+	"http://127.0.0.1:*",
+}
+
+// Device is a device the server can expose.
+type Device struct {
+	Path    string
+	Vendor  uint16
+	Product uint16
+	Profile devices.Device
+	Open    func() (transport.Transport, error)
+}
+
+// Server implements the trezord endpoints /, /enumerate, /listen,
+// /acquire/{path}/{previous}, /release/{session} and /call/{session}.
+type Server struct {
+	Enumerate    func() []Device
+	Origins      []string
+	ListenPeriod time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	lastID   int
+}
+
+type session struct {
+	mu     sync.Mutex
+	id     string
+	path   string
+	t      transport.Transport
+	closed sync.Once
+}
+
+// close closes the device of the session without waiting for a call in
+// progress, which then fails as disconnected.
+func (sess *session) close() {
+	sess.closed.Do(sess.t.Close)
+}
+
+type enumeration struct {
+	Path         string  `json:"path"`
+	Vendor       uint16  `json:"vendor"`
+	Product      uint16  `json:"product"`
+	Session      *string `json:"session"`
+	DebugSession *string `json:"debugSession"`
+	Debug        bool    `json:"debug"`
+}
+
+func NewServer(enumerate func() []Device) *Server {
+	return &Server{
+		Enumerate:    enumerate,
+		Origins:      DefaultOrigins,
+		ListenPeriod: 500 * time.Millisecond,
+		sessions:     map[string]*session{},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		if !s.allowed(origin) {
+			writeError(w, http.StatusForbidden, "Origin not allowed")
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		writeJSON(w, map[string]string{"version": Version})
+	case parts[0] == "enumerate" && len(parts) == 1:
+		writeJSON(w, s.enumerate())
+	case parts[0] == "listen" && len(parts) == 1:
+		s.listen(w, r)
+	case parts[0] == "acquire" && len(parts) == 3:
+		s.acquire(w, parts[1], parts[2])
+	case parts[0] == "release" && len(parts) == 2:
+		s.release(w, parts[1])
+	case parts[0] == "call" && len(parts) == 2:
+		s.call(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) allowed(origin string) bool {
+	for _, pattern := range s.Origins {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) devices() map[string]Device {
+	devs := map[string]Device{}
+	for _, d := range s.Enumerate() {
+		devs[d.Path] = d
+	}
+	return devs
+}
+
+func (s *Server) enumerate() []enumeration {
+	devs := s.Enumerate()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []enumeration{}
+	for _, d := range devs {
+		e := enumeration{
+			Path:    d.Path,
+			Vendor:  d.Vendor,
+			Product: d.Product,
+		}
+		if sess, ok := s.sessions[d.Path]; ok {
+			id := sess.id
+			e.Session = &id
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// listen waits until the enumeration differs from the one in the request
+// body, or until the client goes away.
+func (s *Server) listen(w http.ResponseWriter, r *http.Request) {
+	var previous []enumeration
+	if err := json.NewDecoder(r.Body).Decode(&previous); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid enumeration")
+		return
+	}
+	for {
+		current := s.enumerate()
+		if !reflect.DeepEqual(current, previous) && !(len(current) == 0 && len(previous) == 0) {
+			writeJSON(w, current)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.ListenPeriod):
+		}
+	}
+}
+
+func (s *Server) acquire(w http.ResponseWriter, devPath, previous string) {
+	d, ok := s.devices()[devPath]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "device not found")
+		return
+	}
+
+	s.mu.Lock()
+	current, ok := s.sessions[devPath]
+	if (ok && current.id != previous) || (!ok && previous != "null") {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "wrong previous session")
+		return
+	}
+	if ok {
+		delete(s.sessions, devPath)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		// like trezord, the new session steals the device by closing it under
+		// the previous one, which interrupts its call instead of waiting for it
+		current.close()
+	}
+	t, err := d.Open()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[devPath]; ok {
+		t.Close()
+		writeError(w, http.StatusBadRequest, "wrong previous session")
+		return
+	}
+	s.lastID++
+	sess := &session{id: strconv.Itoa(s.lastID), path: devPath, t: t}
+	s.sessions[devPath] = sess
+	writeJSON(w, map[string]string{"session": sess.id})
+}
+
+func (s *Server) release(w http.ResponseWriter, id string) {
+	sess := s.session(id)
+	if sess == nil {
+		writeError(w, http.StatusBadRequest, "session not found")
+		return
+	}
+	s.drop(sess)
+	writeJSON(w, map[string]string{})
+}
+
+func (s *Server) session(id string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sess := range s.sessions {
+		if sess.id == id {
+			return sess
+		}
+	}
+	return nil
+}
+
+func (s *Server) drop(sess *session) {
+	s.mu.Lock()
+	if s.sessions[sess.path] == sess {
+		delete(s.sessions, sess.path)
+	}
+	s.mu.Unlock()
+	sess.close()
+}
+
+// call forwards a hex encoded type+length+payload message to the device and
+// answers with the device reply in the same encoding.
+func (s *Server) call(w http.ResponseWriter, r *http.Request, id string) {
+	sess := s.session(id)
+	if sess == nil {
+		writeError(w, http.StatusBadRequest, "wrong previous session")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	msg, err := hex.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil || len(msg) < 6 || int(binary.BigEndian.Uint32(msg[2:6])) != len(msg)-6 {
+		writeError(w, http.StatusBadRequest, "malformed data")
+		return
+	}
+
+	sess.mu.Lock()
+	marshalled, msgType, err := s.exchange(r, sess, msg)
+	sess.mu.Unlock()
+	if err != nil {
+		if msgType == transport.DisconnectedError {
+			s.drop(sess)
+			writeError(w, http.StatusBadRequest, "device disconnected during action")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reply := make([]byte, 6, 6+len(marshalled))
+	binary.BigEndian.PutUint16(reply[0:2], msgType)
+	binary.BigEndian.PutUint32(reply[2:6], uint32(len(marshalled)))
+	reply = append(reply, marshalled...)
+	io.WriteString(w, hex.EncodeToString(reply))
+}
+
+// exchange writes msg to the device of sess and waits for its answer, until
+// the client goes away or the session is stolen or released.
+func (s *Server) exchange(r *http.Request, sess *session, msg []byte) ([]byte, uint16, error) {
+	if err := sess.t.Write(append([]byte{35, 35}, msg...)); err != nil {
+		return nil, transport.ErrorKind(err), err
+	}
+	for {
+		marshalled, msgType, _, err := sess.t.Read()
+		if msgType != transport.TimeoutError {
+			return marshalled, msgType, err
+		}
+		if err := r.Context().Err(); err != nil {
+			return nil, transport.TimeoutError, err
+		}
+		if !s.current(sess) {
+			return nil, transport.DisconnectedError, transport.ErrDisconnected
+		}
+	}
+}
+
+// current reports whether sess still holds its device.
+func (s *Server) current(sess *session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sess.path] == sess
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+func mockServer(t *testing.T) (*httptest.Server, *transport.Mock) {
+	d, _ := devices.GetDevice("trezor")
+	mock := transport.NewMock(d.Messages)
+	server := httptest.NewServer(NewServer(func() []Device {
+		return []Device{{
+			Path:    "534c:0001:1",
+			Vendor:  0x534c,
+			Product: 0x0001,
+			Profile: d,
+			Open: func() (transport.Transport, error) {
+				return mock, nil
+			},
+		}}
+	}))
+	t.Cleanup(server.Close)
+	return server, mock
+}
+
+func TestServer(t *testing.T) {
+	server, mock := mockServer(t)
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{Message: proto.String("PONG")})
+
+	client := transport.Bridge{URL: server.URL}
+	devs, err := client.Enumerate()
+	if err != nil || len(devs) != 1 || devs[0].Vendor != 0x534c || devs[0].Session != nil {
+		t.Fatalf("unexpected devices %+v %v", devs, err)
+	}
+	if err = client.Acquire(devs[0].Path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.Write([]byte{35, 35, 0, 1, 0, 0, 0, 2, 10, 0}); err != nil {
+		t.Fatal(err)
+	}
+	marshalled, msgType, _, err := client.Read()
+	if err != nil || msgType != 2 {
+		t.Fatalf("unexpected reply %d %v", msgType, err)
+	}
+	var success trezor.Success
+	if err = proto.Unmarshal(marshalled, &success); err != nil || success.GetMessage() != "PONG" {
+		t.Errorf("unexpected reply %v %v", success, err)
+	}
+	if frames := mock.Frames(); len(frames) != 1 || frames[0].Type != 1 || !bytes.Equal(frames[0].Payload, []byte{10, 0}) {
+		t.Errorf("unexpected frames written %v", frames)
+	}
+
+	// a second client steals the session, the first one is locked out
+	thief := transport.Bridge{URL: server.URL}
+	if err = thief.Acquire(devs[0].Path); err != nil || thief.Session() == client.Session() {
+		t.Fatalf("unexpected session %q %v", thief.Session(), err)
+	}
+	if err = client.Write([]byte{35, 35, 0, 1, 0, 0, 0, 0}); !errors.Is(err, transport.ErrDisconnected) || !strings.Contains(err.Error(), "wrong previous session") {
+		t.Errorf("expected the stolen session to fail, received %v", err)
+	}
+
+	thief.Close()
+	devs, _ = thief.Enumerate()
+	if devs[0].Session != nil {
+		t.Errorf("expected the session to be released, received %q", *devs[0].Session)
+	}
+}
+
+// waitingTransport is a device waiting for the user, its reads time out
+// even once it is closed, like a closed handle whose errors look like
+// timeouts.
+type waitingTransport struct {
+	*transport.Mock
+}
+
+func (t *waitingTransport) Read() ([]byte, uint16, int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return nil, transport.TimeoutError, 0, transport.ErrTimeout
+}
+
+func TestServerStealDuringCall(t *testing.T) {
+	d, _ := devices.GetDevice("trezor")
+	opened := []transport.Transport{
+		&waitingTransport{Mock: transport.NewMock(d.Messages)},
+		transport.NewMock(d.Messages),
+	}
+	server := httptest.NewServer(NewServer(func() []Device {
+		return []Device{{
+			Path:    "534c:0001:1",
+			Profile: d,
+			Open: func() (transport.Transport, error) {
+				t := opened[0]
+				opened = opened[1:]
+				return t, nil
+			},
+		}}
+	}))
+	defer server.Close()
+
+	client := transport.Bridge{URL: server.URL}
+	if err := client.Acquire("534c:0001:1"); err != nil {
+		t.Fatal(err)
+	}
+	called := make(chan error, 1)
+	go func() {
+		called <- client.Write([]byte{35, 35, 0, 1, 0, 0, 0, 0})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the call in progress does not hold back the new session
+	acquired := make(chan error, 1)
+	go func() {
+		thief := transport.Bridge{URL: server.URL}
+		acquired <- thief.Acquire("534c:0001:1")
+	}()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("acquire waited for the call in progress")
+	}
+	select {
+	case err := <-called:
+		if !errors.Is(err, transport.ErrDisconnected) {
+			t.Errorf("expected the interrupted call to fail, received %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the call of the stolen session kept waiting")
+	}
+}
+
+func TestServerOrigin(t *testing.T) {
+	server, _ := mockServer(t)
+	for origin, status := range map[string]int{
+		"https://wallet.trezor.io": http.StatusOK,
+		"http://localhost:8000":    http.StatusOK,
+		"https://evil.example.com": http.StatusForbidden,
+	} {
+		req, _ := http.NewRequest("POST", server.URL+"/enumerate", nil)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("origin %s: expected status %d, received %d", origin, status, resp.StatusCode)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cerrojo
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -23,6 +24,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/conejoninja/cerrojo/devices"
 	"github.com/conejoninja/cerrojo/pb/common"
@@ -34,11 +36,23 @@ import (
 
 const hardkey uint32 = 2147483648
 
+const cancelReads = 20
+
+// Client talks to one device. It is safe for concurrent use once SetTransport
+// has been called, each call holds the device until its whole exchange, PIN
+// and button round-trips included, is done. A Client must not be copied
+// after first use, pass a *Client around.
 type Client struct {
-	t    transport.Transport
-	m    common.Messager
-	tp   types.Typer
-	info devices.Info
+	mu sync.Mutex
+	t  transport.Transport
+	// m, tp and info are the device profile, set by SetTransport and read
+	// by the message builders without mu, so they do not change afterwards
+	m       common.Messager
+	tp      types.Typer
+	info    devices.Info
+	request common.MessageType
+	ui      UI
+	tracer  Tracer
 }
 
 type Storage struct {
@@ -78,14 +92,37 @@ type TxRequest struct {
 	Type    types.RequestType            `json:"type,omitempty"`
 }
 
+// SetTransport sets the transport and the device profile of the client. Call
+// it before the client is shared between goroutines, Reattach is the way to
+// swap the transport of a client in use.
 func (c *Client) SetTransport(t transport.Transport, d devices.Device) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.t = t
 	c.m = d.Messages
 	c.tp = d.Types
 	c.info = d.Info
 }
 
+// Types returns the builders of the device profile types, to build the
+// inputs and outputs given to SignTransaction.
+func (c *Client) Types() types.Typer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tp
+}
+
+// SetUI installs the UI used to answer PIN, passphrase, button and word
+// requests during CallMessage. A nil UI returns those requests to the caller.
+func (c *Client) SetUI(ui UI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ui = ui
+}
+
 func (c *Client) CloseTransport() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.t.Close()
 }
 
@@ -236,6 +273,29 @@ func (c *Client) GetAddress(addressN []uint32, showDisplay bool, coinName string
 	return msg
 }
 
+// GetMultisigAddress asks for the address of the multisig wallet described
+// by multisig, addressN is the path of the device own key in it.
+func (c *Client) GetMultisigAddress(addressN []uint32, showDisplay bool, coinName string, multisig types.MultisigRedeemScriptTyper, scriptType types.InputScriptType) []byte {
+	m := c.m.GetGetAddress()
+	m.SetAddressN(addressN)
+	m.SetCoinName(&coinName)
+	m.SetShowDisplay(&showDisplay)
+	m.SetMultisig(multisig)
+	st := c.tp.GetInputScriptType()
+	types.SetEnum(st, int32(scriptType))
+	m.SetScriptType(st)
+	marshalled, err := proto.Marshal(m)
+
+	if err != nil {
+		fmt.Println("ERROR Marshalling")
+	}
+
+	magicHeader := append([]byte{35, 35}, c.Header(common.MessageType_value["MessageType_MessageType_GetAddress"], marshalled)...)
+	msg := append(magicHeader, marshalled...)
+
+	return msg
+}
+
 func (c *Client) GetPublicKey(address []uint32) []byte {
 	m := c.m.GetGetPublicKey()
 	m.SetAddressN(address)
@@ -504,6 +564,20 @@ func (c *Client) ButtonAck() []byte {
 	return msg
 }
 
+func (c *Client) Cancel() []byte {
+	m := c.m.GetCancel()
+	marshalled, err := proto.Marshal(m)
+
+	if err != nil {
+		fmt.Println("ERROR Marshalling")
+	}
+
+	magicHeader := append([]byte{35, 35}, c.Header(common.MessageType_value["MessageType_MessageType_Cancel"], marshalled)...)
+	msg := append(magicHeader, marshalled...)
+
+	return msg
+}
+
 func (c *Client) GetMasterKey() []byte {
 	masterKey, _ := hex.DecodeString(c.info.MasterKey)
 	return c.CipherKeyValue(
@@ -643,7 +717,7 @@ func (c *Client) SignTx(outputsCount, inputsCount uint32, coinName string, versi
 
 func (c *Client) TxAck(tx types.TransactionTyper) []byte {
 	m := c.m.GetTxAck()
-	m.SetTx(tx)
+	types.SetMessages(m, "tx", tx)
 	marshalled, err := proto.Marshal(m)
 
 	if err != nil {
@@ -706,227 +780,247 @@ func (c *Client) EthereumGetAddress(addressN []uint32, showDisplay bool) []byte
 }
 
 func (c *Client) Call(msg []byte) (string, uint16) {
-	c.t.Write(msg)
-	return c.ReadUntil()
+	return c.MessageString(c.CallMessage(msg))
 }
 
 func (c *Client) ReadUntil() (string, uint16) {
-	var str string
-	var msgType uint16
-	for {
-		str, msgType = c.Read()
-		if msgType != 999 { //timeout
-			break
-		}
-	}
-
-	return str, msgType
+	return c.MessageString(c.ReadUntilMessage())
 }
 
 func (c *Client) Read() (string, uint16) {
-	marshalled, msgType, _, err := c.t.Read()
-	if err != nil {
-		return "Error reading", msgType
+	return c.MessageString(c.ReadMessage())
+}
+
+// CallMessage writes msg to the device and returns its reply decoded as the
+// matching common.* interface type (e.g. common.Featureser). If a UI is set,
+// interactive requests are answered through it until the final reply.
+func (c *Client) CallMessage(msg []byte) (proto.Message, common.MessageType, error) {
+	return c.CallContext(context.Background(), msg)
+}
+
+// CallContext is like CallMessage but gives up when ctx is done, returning
+// ctx.Err(). The pending action is cancelled on the device so it goes back
+// to its home screen, and nothing is sent if ctx is already done.
+func (c *Client) CallContext(ctx context.Context, msg []byte) (proto.Message, common.MessageType, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.call(ctx, msg)
+}
+
+func (c *Client) ReadUntilMessage() (proto.Message, common.MessageType, error) {
+	return c.ReadContext(context.Background())
+}
+
+// ReadContext reads until a reply arrives or ctx is done. In the latter case
+// it cancels the pending action on the device and returns ctx.Err().
+func (c *Client) ReadContext(ctx context.Context) (proto.Message, common.MessageType, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readContext(ctx)
+}
+
+func (c *Client) ReadMessage() (proto.Message, common.MessageType, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readMessage(context.Background())
+}
+
+// call runs a whole request/response exchange, c.mu must be held so
+// exchanges from different goroutines do not interleave.
+func (c *Client) call(ctx context.Context, msg []byte) (proto.Message, common.MessageType, error) {
+	// an abandoned request is not sent, it could start an action on the device
+	if err := ctx.Err(); err != nil {
+		return nil, transport.TimeoutError, err
+	}
+	if len(msg) >= 4 {
+		c.request = common.MessageType(binary.BigEndian.Uint16(msg[2:4]))
 	}
+	return c.exchange(ctx, msg)
+}
 
-	str := "Uncaught message type " + strconv.Itoa(int(msgType))
-	switch common.MessageType(msgType) {
-	case common.MessageType_value["MessageType_MessageType_Success"]:
-		msg := c.m.GetSuccess()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (2)"
-		} else {
-			str = msg.GetMessage()
+// exchange is call without recording msg as the request, for acks sent in
+// the middle of an exchange, so a Failure still reports the caller request.
+func (c *Client) exchange(ctx context.Context, msg []byte) (proto.Message, common.MessageType, error) {
+	for {
+		if err := c.write(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil, transport.TimeoutError, ctx.Err()
+			}
+			return nil, writeErrorType(err), err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_Failure"]:
-		msg := c.m.GetFailure()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (3)"
-		} else {
-			str = msg.GetMessage()
+		reply, msgType, err := c.readContext(ctx)
+		if err != nil || c.ui == nil {
+			return reply, msgType, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_Entropy"]:
-		msg := c.m.GetEntropy()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (10)"
-		} else {
-			str = hex.EncodeToString(msg.GetEntropy())
+
+		msg, err = c.interact(reply, msgType)
+		if err == nil {
+			err = ctx.Err()
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_PublicKey"]:
-		msg := c.m.GetPublicKey()
-		err = proto.Unmarshal(marshalled, msg)
 		if err != nil {
-			str = "Error unmarshalling (12)"
-		} else {
-			smJSON, _ := json.Marshal(msg)
-			str = string(smJSON)
+			c.cancel()
+			return reply, msgType, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_Features"]:
-		msg := c.m.GetFeatures()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (17)"
-		} else {
-			ftsJSON, _ := json.Marshal(msg)
-			str = string(ftsJSON)
+		if msg == nil {
+			return reply, msgType, nil
 		}
-		break
+	}
+}
+
+// interact asks the UI to answer an interactive request and returns the ack
+// to send back, or nil if reply is not an interactive request.
+func (c *Client) interact(reply proto.Message, msgType common.MessageType) ([]byte, error) {
+	switch msgType {
 	case common.MessageType_value["MessageType_MessageType_PinMatrixRequest"]:
-		msg := c.m.GetPinMatrixRequest()
-		err = proto.Unmarshal(marshalled, msg)
+		pin, err := c.ui.RequestPin(types.PinMatrixRequestTyper2Type(reply.(common.PinMatrixRequester).GetType()))
 		if err != nil {
-			str = "Error unmarshalling (18)"
-		} else {
-			msgSubType := msg.GetType()
-			if msgSubType.String() == "1" {
-				str = "Please enter current PIN:"
-			} else if msgSubType.String() == "2" {
-				str = "Please enter new PIN:"
-			} else {
-				str = "Please re-enter new PIN:"
-			}
+			return nil, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_TxRequest"]:
-		msg := c.m.GetTxRequest()
-		err = proto.Unmarshal(marshalled, msg)
+		return c.PinMatrixAck(pin), nil
+	case common.MessageType_value["MessageType_MessageType_PassphraseRequest"]:
+		passphrase, err := c.ui.RequestPassphrase()
 		if err != nil {
-			str = "Error unmarshalling (21)"
-		} else {
-			txreq := c.m.GetTxRequest()
-			d := msg.GetDetails()
-			txreq.SetDetails(d)
-			txreq.SetRequestType(msg.GetRequestType())
-			smJSON, _ := json.Marshal(msg)
-			str = string(smJSON)
+			return nil, err
 		}
-		break
+		return c.PassphraseAck(passphrase), nil
 	case common.MessageType_value["MessageType_MessageType_ButtonRequest"]:
-		msg := c.m.GetButtonRequest()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (26)"
-		} else {
-			str = "Confirm action on device"
+		if err := c.ui.ButtonRequest(types.ButtonRequestTyper2Type(reply.(common.ButtonRequester).GetCode())); err != nil {
+			return nil, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_Address"]:
-		msg := c.m.GetAddress()
-		err = proto.Unmarshal(marshalled, msg)
+		return c.ButtonAck(), nil
+	case common.MessageType_value["MessageType_MessageType_WordRequest"]:
+		word, err := c.ui.RequestWord(types.WordRequestTyper2Type(reply.(common.WordRequester).GetType()))
 		if err != nil {
-			str = "Error unmarshalling (30)"
-		} else {
-			str = msg.GetAddress()
+			return nil, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_EntropyRequest"]:
-		externalEntropy, _ := GenerateRandomBytes(32)
-		str, msgType = c.Call(c.EntropyAck(externalEntropy))
-		break
-	case common.MessageType_value["MessageType_MessageType_MessageSignature"]:
-		msg := c.m.GetMessageSignature()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (40)"
-		} else {
-			smJSON, _ := json.Marshal(msg)
-			str = string(smJSON)
+		return c.WordAck(word), nil
+	}
+	return nil, nil
+}
+
+func (c *Client) readContext(ctx context.Context) (proto.Message, common.MessageType, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			c.cancel()
+			return nil, transport.TimeoutError, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_PassphraseRequest"]:
-		msg := c.m.GetPassphraseRequest()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (41)"
-		} else {
-			str = "Enter your passphrase"
+		msg, msgType, err := c.readMessage(ctx)
+		if msgType != transport.TimeoutError {
+			return msg, msgType, err
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_TxSize"]:
-		msg := c.m.GetTxSize()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (44)"
-		} else {
-			str = strconv.Itoa(int(msg.GetTxSize()))
+	}
+}
+
+// cancel sends Cancel to the device and drains its answer, giving up after
+// cancelReads read timeouts so a dead device does not block the caller.
+func (c *Client) cancel() {
+	if c.write(context.Background(), c.Cancel()) != nil {
+		return
+	}
+	for i := 0; i < cancelReads; i++ {
+		if _, msgType, _ := c.readMessage(context.Background()); msgType != transport.TimeoutError {
+			return
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_WordRequest"]:
-		msg := c.m.GetWordRequest()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (46)"
-		} else {
-			str = "Enter the word"
+	}
+}
+
+// writeErrorType returns the transport error code of a failed write, errors
+// from transports not using transport.Error count as endpoint errors.
+func writeErrorType(err error) common.MessageType {
+	if kind := transport.ErrorKind(err); kind != 0 {
+		return common.MessageType(kind)
+	}
+	return transport.EndpointError
+}
+
+func (c *Client) readMessage(ctx context.Context) (proto.Message, common.MessageType, error) {
+	marshalled, t, _, err := c.t.Read()
+	msgType := common.MessageType(t)
+	if err != nil {
+		return nil, msgType, err
+	}
+	c.trace(transport.Received, msgType, marshalled)
+
+	if msgType == common.MessageType_value["MessageType_MessageType_EntropyRequest"] {
+		externalEntropy, _ := GenerateRandomBytes(32)
+		return c.exchange(ctx, c.EntropyAck(externalEntropy))
+	}
+
+	msg := common.NewMessage(c.m, msgType)
+	if msg == nil {
+		return nil, msgType, errors.New("Uncaught message type " + strconv.Itoa(int(msgType)))
+	}
+	if err = proto.Unmarshal(marshalled, msg); err != nil {
+		return nil, msgType, err
+	}
+	if msgType == common.MessageType_value["MessageType_MessageType_Failure"] {
+		return msg, msgType, newDeviceError(msg.(common.Failurer), c.request)
+	}
+	return msg, msgType, nil
+}
+
+// MessageString converts a decoded reply into the legacy (string, uint16) form
+// returned by Call, ReadUntil and Read.
+func (c *Client) MessageString(msg proto.Message, msgType common.MessageType, err error) (string, uint16) {
+	var deviceErr *DeviceError
+	if errors.As(err, &deviceErr) {
+		return deviceErr.Message, uint16(msgType)
+	}
+	if err != nil {
+		if msgType >= transport.TimeoutError {
+			return "Error reading", uint16(msgType)
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_CipheredKeyValue"]:
-		msg := c.m.GetCipheredKeyValue()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (48)"
-		} else {
-			str = string(msg.GetValue())
+		if common.NewMessage(c.m, msgType) == nil {
+			return "Uncaught message type " + strconv.Itoa(int(msgType)), uint16(msgType)
 		}
-		break
-	case common.MessageType_value["MessageType_MessageType_EncryptedMessage"]:
-		msg := c.m.GetEncryptedMessage()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (50)"
+		return "Error unmarshalling (" + strconv.Itoa(int(msgType)) + ")", uint16(msgType)
+	}
+
+	str := "Uncaught message type " + strconv.Itoa(int(msgType))
+	switch msgType {
+	case common.MessageType_value["MessageType_MessageType_Success"]:
+		str = msg.(common.Successer).GetMessage()
+	case common.MessageType_value["MessageType_MessageType_Failure"]:
+		str = msg.(common.Failurer).GetMessage()
+	case common.MessageType_value["MessageType_MessageType_Entropy"]:
+		str = hex.EncodeToString(msg.(common.Entropyer).GetEntropy())
+	case common.MessageType_value["MessageType_MessageType_PinMatrixRequest"]:
+		msgSubType := msg.(common.PinMatrixRequester).GetType()
+		if msgSubType.String() == "1" {
+			str = "Please enter current PIN:"
+		} else if msgSubType.String() == "2" {
+			str = "Please enter new PIN:"
 		} else {
-			smJSON, _ := json.Marshal(msg)
-			str = string(smJSON)
+			str = "Please re-enter new PIN:"
 		}
-		break
+	case common.MessageType_value["MessageType_MessageType_ButtonRequest"]:
+		str = "Confirm action on device"
+	case common.MessageType_value["MessageType_MessageType_Address"]:
+		str = msg.(common.Addresser).GetAddress()
+	case common.MessageType_value["MessageType_MessageType_PassphraseRequest"]:
+		str = "Enter your passphrase"
+	case common.MessageType_value["MessageType_MessageType_TxSize"]:
+		str = strconv.Itoa(int(msg.(common.TxSizer).GetTxSize()))
+	case common.MessageType_value["MessageType_MessageType_WordRequest"]:
+		str = "Enter the word"
+	case common.MessageType_value["MessageType_MessageType_CipheredKeyValue"]:
+		str = string(msg.(common.CipheredKeyValuer).GetValue())
 	case common.MessageType_value["MessageType_MessageType_DecryptedMessage"]:
-		msg := c.m.GetDecryptedMessage()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (52)"
-		} else {
-			str = string(msg.GetMessage())
-		}
-		break
-	case common.MessageType_value["MessageType_MessageType_SignedIdentity"]:
-		msg := c.m.GetSignedIdentity()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (54)"
-		} else {
-			smJSON, _ := json.Marshal(msg)
-			str = string(smJSON)
-		}
-		break
+		str = string(msg.(common.DecryptedMessager).GetMessage())
 	case common.MessageType_value["MessageType_MessageType_EthereumAddress"]:
-		msg := c.m.GetEthereumAddress()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (57)"
-		} else {
-			str = hex.EncodeToString(msg.GetAddress())
-		}
-		break
+		str = hex.EncodeToString(msg.(common.EthereumAddresser).GetAddress())
 	case common.MessageType_value["MessageType_MessageType_ECDHSessionKey"]:
-		msg := c.m.GetECDHSessionKey()
-		err = proto.Unmarshal(marshalled, msg)
-		if err != nil {
-			str = "Error unmarshalling (62)"
-		} else {
-			str = string(msg.GetSessionKey())
-		}
-		break
-	default:
-		break
-	}
-	return str, msgType
+		str = string(msg.(common.ECDHSessionKeyer).GetSessionKey())
+	case common.MessageType_value["MessageType_MessageType_PublicKey"],
+		common.MessageType_value["MessageType_MessageType_Features"],
+		common.MessageType_value["MessageType_MessageType_TxRequest"],
+		common.MessageType_value["MessageType_MessageType_MessageSignature"],
+		common.MessageType_value["MessageType_MessageType_EncryptedMessage"],
+		common.MessageType_value["MessageType_MessageType_SignedIdentity"]:
+		smJSON, _ := json.Marshal(msg)
+		str = string(smJSON)
+	}
+	return str, uint16(msgType)
 }
 
 func BIP32Path(keys []uint32) string {
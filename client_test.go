@@ -0,0 +1,283 @@
+package cerrojo
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+func mockClient() (*Client, *transport.Mock) {
+	d, _ := devices.GetDevice("trezor")
+	mock := transport.NewMock(d.Messages)
+	var c Client
+	c.SetTransport(mock, d)
+	return &c, mock
+}
+
+func reply(t *testing.T, mock *transport.Mock, name string, msg proto.Message) {
+	if err := mock.Reply(common.MessageType_value["MessageType_MessageType_"+name], msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func written(mock *transport.Mock) []common.MessageType {
+	var msgTypes []common.MessageType
+	for _, f := range mock.Frames() {
+		msgTypes = append(msgTypes, f.Type)
+	}
+	return msgTypes
+}
+
+func TestCallMessageFeatures(t *testing.T) {
+	c, mock := mockClient()
+	reply(t, mock, "Features", &trezor.Features{Label: proto.String("My TREZOR"), MajorVersion: proto.Uint32(1)})
+
+	msg, msgType, err := c.CallMessage(c.GetFeatures())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != common.MessageType_value["MessageType_MessageType_Features"] {
+		t.Fatalf("expected Features, received %d", msgType)
+	}
+	features, ok := msg.(common.Featureser)
+	if !ok {
+		t.Fatalf("expected common.Featureser, received %T", msg)
+	}
+	if features.GetLabel() != "My TREZOR" || features.GetMajorVersion() != 1 {
+		t.Errorf("unexpected features %v", features)
+	}
+
+	requests, err := mock.Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := requests[0].(common.GetFeatureser); !ok || len(requests) != 1 {
+		t.Errorf("expected a single GetFeatures, written %v", requests)
+	}
+}
+
+func TestCallString(t *testing.T) {
+	c, mock := mockClient()
+	reply(t, mock, "Success", &trezor.Success{Message: proto.String("PONG")})
+
+	str, msgType := c.Call(c.Ping("PONG", false, false, false))
+	if msgType != 2 || str != "PONG" {
+		t.Errorf("expected (\"PONG\", 2), received (%q, %d)", str, msgType)
+	}
+}
+
+func TestDeviceError(t *testing.T) {
+	c, mock := mockClient()
+	reply(t, mock, "Failure", &trezor.Failure{
+		Code:    trezortypes.FailureType_Failure_PinInvalid.Enum(),
+		Message: proto.String("PIN invalid"),
+	})
+
+	_, _, err := c.CallMessage(c.GetAddress(StringToBIP32Path("m/44'/0'/0'"), false, "Bitcoin"))
+	if !errors.Is(err, ErrPinInvalid) || errors.Is(err, ErrActionCancelled) {
+		t.Fatalf("expected ErrPinInvalid, received %v", err)
+	}
+	var deviceErr *DeviceError
+	if !errors.As(err, &deviceErr) {
+		t.Fatalf("expected a DeviceError, received %T", err)
+	}
+	if deviceErr.Request != common.MessageType_value["MessageType_MessageType_GetAddress"] || deviceErr.Message != "PIN invalid" {
+		t.Errorf("unexpected DeviceError %+v", deviceErr)
+	}
+	if err.Error() != "Failure_PinInvalid: PIN invalid" {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+
+	// the EntropyAck sent in the middle of ResetDevice is not the request
+	reply(t, mock, "EntropyRequest", &trezor.EntropyRequest{})
+	reply(t, mock, "Failure", &trezor.Failure{Code: trezortypes.FailureType_Failure_ActionCancelled.Enum()})
+	_, _, err = c.CallMessage(c.ResetDevice(false, 128, false, false, "", 0))
+	if !errors.As(err, &deviceErr) || deviceErr.Request != common.MessageType_value["MessageType_MessageType_ResetDevice"] {
+		t.Errorf("expected a DeviceError for ResetDevice, received %+v", err)
+	}
+}
+
+func TestUI(t *testing.T) {
+	c, mock := mockClient()
+	ui := &ScriptedUI{Pins: []string{"1234"}}
+	c.SetUI(ui)
+	reply(t, mock, "PinMatrixRequest", &trezor.PinMatrixRequest{Type: trezortypes.PinMatrixRequestType_PinMatrixRequestType_Current.Enum()})
+	reply(t, mock, "ButtonRequest", &trezor.ButtonRequest{Code: trezortypes.ButtonRequestType_ButtonRequest_ConfirmOutput.Enum()})
+	reply(t, mock, "Address", &trezor.Address{Address: proto.String("1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL")})
+
+	str, msgType := c.Call(c.GetAddress(StringToBIP32Path("m/44'/0'/0'"), true, "Bitcoin"))
+	if msgType != 30 || str != "1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL" {
+		t.Fatalf("unexpected reply (%q, %d)", str, msgType)
+	}
+
+	expected := []common.MessageType{29, 19, 27}
+	msgTypes := written(mock)
+	if len(msgTypes) != len(expected) {
+		t.Fatalf("expected %v written, received %v", expected, msgTypes)
+	}
+	for i := range expected {
+		if msgTypes[i] != expected[i] {
+			t.Fatalf("expected %v written, received %v", expected, msgTypes)
+		}
+	}
+
+	requests, _ := mock.Written()
+	if pin := requests[1].(common.PinMatrixAcker).GetPin(); pin != "1234" {
+		t.Errorf("expected PIN 1234, sent %q", pin)
+	}
+	if len(ui.Buttons) != 1 || ui.Buttons[0] != types.ButtonRequestType(trezortypes.ButtonRequestType_ButtonRequest_ConfirmOutput) {
+		t.Errorf("unexpected button requests %v", ui.Buttons)
+	}
+}
+
+func TestUIExhausted(t *testing.T) {
+	c, mock := mockClient()
+	c.SetUI(&ScriptedUI{})
+	reply(t, mock, "PassphraseRequest", &trezor.PassphraseRequest{})
+	reply(t, mock, "Failure", &trezor.Failure{Code: trezortypes.FailureType_Failure_ActionCancelled.Enum()})
+
+	_, _, err := c.CallMessage(c.GetPublicKey(StringToBIP32Path("m/44'/0'/0'")))
+	if err != ErrScriptExhausted {
+		t.Fatalf("expected ErrScriptExhausted, received %v", err)
+	}
+	msgTypes := written(mock)
+	if last := msgTypes[len(msgTypes)-1]; last != common.MessageType_value["MessageType_MessageType_Cancel"] {
+		t.Errorf("expected Cancel to be sent, written %v", msgTypes)
+	}
+	if mock.Pending() != 0 {
+		t.Errorf("expected the cancel answer to be drained")
+	}
+}
+
+// cancelUI cancels the call context when the device asks for a button.
+type cancelUI struct {
+	ScriptedUI
+	cancel context.CancelFunc
+}
+
+func (u *cancelUI) ButtonRequest(code types.ButtonRequestType) error {
+	u.cancel()
+	return nil
+}
+
+func TestCallContextCancel(t *testing.T) {
+	c, mock := mockClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.SetUI(&cancelUI{cancel: cancel})
+	reply(t, mock, "ButtonRequest", &trezor.ButtonRequest{Code: trezortypes.ButtonRequestType_ButtonRequest_Other.Enum()})
+	mock.Timeout(3)
+	reply(t, mock, "Failure", &trezor.Failure{Code: trezortypes.FailureType_Failure_ActionCancelled.Enum()})
+
+	_, _, err := c.CallContext(ctx, c.GetAddress(StringToBIP32Path("m/44'/0'/0'"), true, "Bitcoin"))
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, received %v", err)
+	}
+	msgTypes := written(mock)
+	if len(msgTypes) != 2 || msgTypes[1] != common.MessageType_value["MessageType_MessageType_Cancel"] {
+		t.Errorf("expected GetAddress and Cancel written, received %v", msgTypes)
+	}
+	if mock.Pending() != 0 {
+		t.Errorf("expected the cancel answer to be drained")
+	}
+
+	// a context already done sends nothing
+	if _, _, err = c.CallContext(ctx, c.WipeDevice()); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, received %v", err)
+	}
+	if len(written(mock)) != 2 {
+		t.Errorf("expected nothing more written, received %v", written(mock))
+	}
+}
+
+func TestCallWriteError(t *testing.T) {
+	c, mock := mockClient()
+	mock.Close()
+	_, msgType, err := c.CallMessage(c.Ping("hello", false, false, false))
+	if !errors.Is(err, transport.ErrDisconnected) || msgType != transport.DisconnectedError {
+		t.Fatalf("expected a disconnected error, received %d %v", msgType, err)
+	}
+	if len(written(mock)) != 0 {
+		t.Errorf("expected nothing written")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// record a GetAddress asking for the PIN and a button press
+	c, mock := mockClient()
+	recorder := transport.NewRecorder(mock, &trezor.Getter{})
+	d, _ := devices.GetDevice("trezor")
+	c.SetTransport(recorder, d)
+	c.SetUI(&ScriptedUI{Pins: []string{"1234"}})
+	reply(t, mock, "PinMatrixRequest", &trezor.PinMatrixRequest{})
+	reply(t, mock, "ButtonRequest", &trezor.ButtonRequest{})
+	reply(t, mock, "Address", &trezor.Address{Address: proto.String("1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL")})
+	getAddress := c.GetAddress(StringToBIP32Path("m/44'/0'/0'"), true, "Bitcoin")
+	if str, _ := c.Call(getAddress); str != "1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL" {
+		t.Fatalf("unexpected recorded reply %q", str)
+	}
+
+	// the same session replays without device
+	replayer := transport.NewReplayer(recorder.Cassette())
+	c.SetTransport(replayer, d)
+	c.SetUI(&ScriptedUI{Pins: []string{"1234"}})
+	if str, _ := c.Call(getAddress); str != "1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL" || replayer.Pending() != 0 {
+		t.Errorf("unexpected replayed reply %q", str)
+	}
+
+	// the PIN is not recorded, a different address does not match
+	for _, f := range recorder.Cassette().Frames {
+		if strings.Contains(string(f.Message), "1234") || strings.Contains(f.Payload, hex.EncodeToString([]byte("1234"))) {
+			t.Errorf("expected the PIN to be redacted, recorded %+v", f)
+		}
+	}
+	replayer = transport.NewReplayer(recorder.Cassette())
+	c.SetTransport(replayer, d)
+	if _, _, err := c.CallMessage(c.GetAddress(StringToBIP32Path("m/44'/0'/1'"), true, "Bitcoin")); !errors.Is(err, transport.ErrProtocol) {
+		t.Errorf("expected the replay to fail, received %v", err)
+	}
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	c, mock := mockClient()
+	const calls = 20
+	for i := 0; i < calls; i++ {
+		reply(t, mock, "PinMatrixRequest", &trezor.PinMatrixRequest{})
+		reply(t, mock, "Success", &trezor.Success{Message: proto.String("PONG")})
+	}
+	ui := &ScriptedUI{}
+	for i := 0; i < calls; i++ {
+		ui.Pins = append(ui.Pins, "1234")
+	}
+	c.SetUI(ui)
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if str, msgType := c.Call(c.Ping("PONG", true, false, false)); msgType != 2 || str != "PONG" {
+				t.Errorf("unexpected reply (%q, %d)", str, msgType)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every Ping must be directly followed by its own PinMatrixAck
+	msgTypes := written(mock)
+	for i := 0; i < len(msgTypes); i += 2 {
+		if msgTypes[i] != 1 || msgTypes[i+1] != 19 {
+			t.Fatalf("exchanges interleaved: %v", msgTypes)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Command cerrojo runs tools built on the cerrojo package.
+//
+// cerrojo bridge serves the connected TREZOR and KeepKey devices over the
+// trezord HTTP API, as a drop-in replacement for the official bridge.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/conejoninja/cerrojo/bridge"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "bridge":
+		runBridge(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: cerrojo bridge [-listen address] [-origins patterns]")
+	os.Exit(2)
+}
+
+func runBridge(args []string) {
+	fs := flag.NewFlagSet("bridge", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:21325", "address to listen on")
+	origins := fs.String("origins", strings.Join(bridge.DefaultOrigins, ","), "comma separated origins allowed, as path.Match patterns")
+	fs.Parse(args)
+
+	server := bridge.NewServer(bridge.USBDevices)
+	server.Origins = strings.Split(*origins, ",")
+
+	log.Printf("Listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -1,6 +1,10 @@
 package devices
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	keepkey "github.com/conejoninja/cerrojo/pb/keepkey/messages"
 	keepkeytypes "github.com/conejoninja/cerrojo/pb/keepkey/types"
 	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
@@ -21,10 +25,24 @@ type Info struct {
 	Vendor    uint16
 	Product   uint16
 	Interface uint8
+	// MoreIDs are other vendor/product pairs speaking the same protocol,
+	// e.g. newer models of the same device.
+	MoreIDs []USBID
+	// WebUSB devices talk through their vendor-class interface, with the
+	// WebUSB transport instead of HID.
+	WebUSB bool
+}
+
+// USBID is a USB vendor/product pair.
+type USBID struct {
+	Vendor  uint16
+	Product uint16
 }
 
 var Devices map[string]Device
 
+var mu sync.RWMutex
+
 func init() {
 	Devices = map[string]Device{
 		"trezor": Device{
@@ -36,6 +54,24 @@ func init() {
 				Vendor:    21324, //0x534c
 				Product:   1,     // 0x0001
 				Interface: 0,     // 0x00
+				MoreIDs: []USBID{
+					{Vendor: 4617, Product: 21441}, // 0x1209:0x53c1 TREZOR T, HID-mode firmware
+				},
+			},
+		},
+		"trezor-webusb": Device{
+			Messages: &trezor.Getter{},
+			Types:    &trezortypes.Getter{},
+			Info: Info{
+				Name:      "TREZOR",
+				MasterKey: "2d650551248d792eabf628f451200d7f51cb63e46aadcbb1038aacb05e8c8aee2d650551248d792eabf628f451200d7f51cb63e46aadcbb1038aacb05e8c8aee",
+				Vendor:    4617,  // 0x1209
+				Product:   21441, // 0x53c1
+				Interface: 0,     // 0x00
+				MoreIDs: []USBID{
+					{Vendor: 4617, Product: 21440}, // 0x1209:0x53c0 bootloader
+				},
+				WebUSB: true,
 			},
 		},
 		"keepkey": Device{
@@ -53,14 +89,76 @@ func init() {
 
 }
 
-func GetDevices() map[string]Device {
-	return Devices
+// IDs returns every vendor/product pair of the device.
+func (i Info) IDs() []USBID {
+	return append([]USBID{{Vendor: i.Vendor, Product: i.Product}}, i.MoreIDs...)
 }
 
-func GetDevice(key string) Device {
-	if _, ok := Devices[key]; ok {
-		return Devices[key]
+// Matches reports whether a USB device with the given vendor, product and
+// interface is this device.
+func (i Info) Matches(vendor, product uint16, iface uint8) bool {
+	if iface != i.Interface {
+		return false
+	}
+	for _, id := range i.IDs() {
+		if id.Vendor == vendor && id.Product == product {
+			return true
+		}
 	}
-	var d Device
-	return d
+	return false
+}
+
+// Register adds a device profile under name, e.g. for a clone or a model
+// cerrojo does not know about. It fails if the profile is incomplete, if
+// name is taken or if another profile of the same transport already matches
+// one of its USB IDs.
+func Register(name string, d Device) error {
+	switch {
+	case name == "":
+		return errors.New("devices: empty name")
+	case d.Messages == nil || d.Types == nil:
+		return fmt.Errorf("devices: %s: missing messages or types", name)
+	case d.Info.Name == "":
+		return fmt.Errorf("devices: %s: missing info name", name)
+	}
+	for _, id := range d.Info.IDs() {
+		if id.Vendor == 0 || id.Product == 0 {
+			return fmt.Errorf("devices: %s: invalid USB ID %04x:%04x", name, id.Vendor, id.Product)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := Devices[name]; ok {
+		return fmt.Errorf("devices: %s already registered", name)
+	}
+	for other, o := range Devices {
+		if o.Info.WebUSB != d.Info.WebUSB {
+			continue
+		}
+		for _, id := range d.Info.IDs() {
+			if o.Info.Matches(id.Vendor, id.Product, d.Info.Interface) {
+				return fmt.Errorf("devices: %s: USB ID %04x:%04x already used by %s", name, id.Vendor, id.Product, other)
+			}
+		}
+	}
+	Devices[name] = d
+	return nil
+}
+
+func GetDevices() map[string]Device {
+	mu.RLock()
+	defer mu.RUnlock()
+	devs := make(map[string]Device, len(Devices))
+	for name, d := range Devices {
+		devs[name] = d
+	}
+	return devs
+}
+
+func GetDevice(key string) (Device, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := Devices[key]
+	return d, ok
 }
@@ -0,0 +1,90 @@
+package devices
+
+import (
+	"strings"
+	"testing"
+
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+)
+
+func TestMatches(t *testing.T) {
+	d, ok := GetDevice("trezor")
+	if !ok {
+		t.Fatal("trezor profile not registered")
+	}
+	for _, test := range []struct {
+		vendor, product uint16
+		iface           uint8
+		match           bool
+	}{
+		{0x534c, 0x0001, 0, true},
+		{0x1209, 0x53c1, 0, true},
+		{0x534c, 0x0001, 1, false},
+		{0x2b24, 0x0001, 0, false},
+	} {
+		if d.Info.Matches(test.vendor, test.product, test.iface) != test.match {
+			t.Errorf("%04x:%04x interface %d: expected match %v", test.vendor, test.product, test.iface, test.match)
+		}
+	}
+	if _, ok = GetDevice("nope"); ok {
+		t.Error("expected unknown profile not to be found")
+	}
+}
+
+func TestMatchesOneProfile(t *testing.T) {
+	devs := GetDevices()
+	for name, d := range devs {
+		for _, id := range d.Info.IDs() {
+			var matched []string
+			for other, o := range devs {
+				if o.Info.WebUSB == d.Info.WebUSB && o.Info.Matches(id.Vendor, id.Product, d.Info.Interface) {
+					matched = append(matched, other)
+				}
+			}
+			if len(matched) != 1 {
+				t.Errorf("%s: %04x:%04x matches %v", name, id.Vendor, id.Product, matched)
+			}
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	clone := Device{
+		Messages: &trezor.Getter{},
+		Types:    &trezortypes.Getter{},
+		Info:     Info{Name: "CLONE", Vendor: 0x1209, Product: 0x0001},
+	}
+	for _, test := range []struct {
+		name string
+		d    Device
+		err  string
+	}{
+		{"", clone, "empty name"},
+		{"clone", Device{Info: clone.Info}, "missing messages"},
+		{"clone", Device{Messages: clone.Messages, Types: clone.Types, Info: Info{Vendor: 1, Product: 1}}, "missing info name"},
+		{"clone", Device{Messages: clone.Messages, Types: clone.Types, Info: Info{Name: "CLONE"}}, "invalid USB ID"},
+		{"trezor", clone, "already registered"},
+		{"clone", Device{Messages: clone.Messages, Types: clone.Types, Info: Info{Name: "CLONE", Vendor: 0x1209, Product: 0x53c1}}, "already used by trezor"},
+		{"clone", Device{Messages: clone.Messages, Types: clone.Types, Info: Info{Name: "CLONE", Vendor: 0x1209, Product: 0x53c1, WebUSB: true}}, "already used by trezor-webusb"},
+	} {
+		if err := Register(test.name, test.d); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error %q, received %v", test.name, test.err, err)
+		}
+	}
+
+	if err := Register("clone", clone); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mu.Lock()
+		delete(Devices, "clone")
+		mu.Unlock()
+	}()
+	if d, ok := GetDevice("clone"); !ok || !d.Info.Matches(0x1209, 0x0001, 0) {
+		t.Errorf("unexpected registered profile %+v", d.Info)
+	}
+	if _, ok := GetDevices()["clone"]; !ok {
+		t.Error("expected the clone in GetDevices")
+	}
+}
@@ -0,0 +1,89 @@
+package cerrojo
+
+import (
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/karalabe/usb"
+)
+
+// Descriptor describes a connected device, as listed by Enumerate.
+type Descriptor struct {
+	Vendor    string
+	VendorID  uint16
+	ProductID uint16
+	Path      string
+	Serial    string
+	Interface int
+	Profile   devices.Device
+
+	open func() (transport.Transport, error)
+}
+
+// usbEnumerate lists the USB HID and raw (WebUSB) devices, replaced in tests.
+var usbEnumerate = func() (hids, raws []usb.DeviceInfo) {
+	hids, _ = usb.EnumerateHid(0, 0)
+	raws, _ = usb.EnumerateRaw(0, 0)
+	return hids, raws
+}
+
+// usbOpen opens a USB device, replaced in tests.
+var usbOpen = func(info usb.DeviceInfo, webUSB bool) (transport.Transport, error) {
+	if webUSB {
+		return transport.NewWebUSB(info)
+	}
+	return transport.NewHIDAPI(info)
+}
+
+// Enumerate lists every connected device matching a profile of the devices
+// registry, HID devices and WebUSB ones.
+func Enumerate() []Descriptor {
+	var descs []Descriptor
+	hids, raws := usbEnumerate()
+	descs = appendMatches(descs, hids, false)
+	descs = appendMatches(descs, raws, true)
+	return descs
+}
+
+func appendMatches(descs []Descriptor, infos []usb.DeviceInfo, webUSB bool) []Descriptor {
+	profiles := devices.GetDevices()
+	for _, info := range infos {
+		info := info
+		if info.Interface < 0 {
+			continue
+		}
+		for _, d := range profiles {
+			if d.Info.WebUSB == webUSB && d.Info.Matches(info.VendorID, info.ProductID, uint8(info.Interface)) {
+				descs = append(descs, Descriptor{
+					Vendor:    d.Info.Name,
+					VendorID:  info.VendorID,
+					ProductID: info.ProductID,
+					Path:      info.Path,
+					Serial:    info.Serial,
+					Interface: info.Interface,
+					Profile:   d,
+					open: func() (transport.Transport, error) {
+						return usbOpen(info, webUSB)
+					},
+				})
+				break
+			}
+		}
+	}
+	return descs
+}
+
+// Transport opens the device and returns its transport, HIDAPI or WebUSB.
+func (d Descriptor) Transport() (transport.Transport, error) {
+	return d.open()
+}
+
+// Open opens the device and returns a Client ready to talk to it.
+func (d Descriptor) Open() (*Client, error) {
+	t, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	var c Client
+	c.SetTransport(t, d.Profile)
+	return &c, nil
+}
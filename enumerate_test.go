@@ -0,0 +1,112 @@
+package cerrojo
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+	"github.com/karalabe/usb"
+)
+
+// fakeUSB is a USB bus devices can be plugged into and out of, it stands in
+// for the usb library in every test.
+type fakeUSB struct {
+	mu     sync.Mutex
+	hids   []usb.DeviceInfo
+	raws   []usb.DeviceInfo
+	opener func(usb.DeviceInfo) (transport.Transport, error)
+}
+
+var bus = &fakeUSB{}
+
+func TestMain(m *testing.M) {
+	usbEnumerate = bus.enumerate
+	usbOpen = bus.open
+	WatchPeriod = 5 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+// plug replaces the connected devices with the HID devices infos.
+func (u *fakeUSB) plug(infos ...usb.DeviceInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.hids, u.raws = infos, nil
+}
+
+// plugWebUSB adds WebUSB devices to the connected ones.
+func (u *fakeUSB) plugWebUSB(infos ...usb.DeviceInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.raws = append(u.raws, infos...)
+}
+
+// onOpen sets what opening a device returns.
+func (u *fakeUSB) onOpen(opener func(usb.DeviceInfo) (transport.Transport, error)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.opener = opener
+}
+
+func (u *fakeUSB) enumerate() ([]usb.DeviceInfo, []usb.DeviceInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]usb.DeviceInfo{}, u.hids...), append([]usb.DeviceInfo{}, u.raws...)
+}
+
+func (u *fakeUSB) open(info usb.DeviceInfo, webUSB bool) (transport.Transport, error) {
+	u.mu.Lock()
+	opener := u.opener
+	u.mu.Unlock()
+	if opener == nil {
+		return nil, errors.New("usb: cannot open device")
+	}
+	return opener(info)
+}
+
+func TestEnumerate(t *testing.T) {
+	bus.plug(
+		usb.DeviceInfo{Path: "1-1:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "A1"},
+		usb.DeviceInfo{Path: "1-2:1.0", VendorID: 0x046d, ProductID: 0xc52b, Serial: "MOUSE"},
+		usb.DeviceInfo{Path: "1-3:1.1", VendorID: 0x534c, ProductID: 0x0001, Serial: "A1", Interface: 1},
+		usb.DeviceInfo{Path: "1-4:1.0", VendorID: 0x2b24, ProductID: 0x0001, Serial: "K1"},
+	)
+	bus.plugWebUSB(usb.DeviceInfo{Path: "1209:53c1:05", VendorID: 0x1209, ProductID: 0x53c1, Serial: "T1"})
+
+	descs := Enumerate()
+	if len(descs) != 3 {
+		t.Fatalf("expected 3 devices, received %+v", descs)
+	}
+	if d := descs[0]; d.Vendor != "TREZOR" || d.Path != "1-1:1.0" || d.Serial != "A1" || d.Profile.Info.Vendor != 0x534c {
+		t.Errorf("unexpected TREZOR descriptor %+v", d)
+	}
+	if d := descs[1]; d.Vendor != "KEEPKEY" || d.Path != "1-4:1.0" || d.Serial != "K1" {
+		t.Errorf("unexpected KeepKey descriptor %+v", d)
+	}
+	if d := descs[2]; d.Vendor != "TREZOR" || d.Serial != "T1" || !d.Profile.Info.WebUSB {
+		t.Errorf("unexpected TREZOR T descriptor %+v", d)
+	}
+}
+
+func TestDescriptorOpen(t *testing.T) {
+	bus.plug(usb.DeviceInfo{Path: "1-1:1.0", VendorID: 0x534c, ProductID: 0x0001})
+	d := Enumerate()
+
+	mock := transport.NewMock(d[0].Profile.Messages)
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{Message: proto.String("PONG")})
+	bus.onOpen(func(usb.DeviceInfo) (transport.Transport, error) { return mock, nil })
+	defer bus.onOpen(nil)
+
+	c, err := d[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str, _ := c.Call(c.Ping("PONG", false, false, false)); str != "PONG" {
+		t.Errorf("unexpected answer %q", str)
+	}
+}
@@ -0,0 +1,59 @@
+package cerrojo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// DeviceError is returned when the device answers with a Failure message.
+// Use errors.Is with the Err* values below to check the reason.
+type DeviceError struct {
+	Code    types.FailureType
+	Message string
+	Request common.MessageType
+}
+
+var (
+	ErrUnexpectedMessage = &DeviceError{Code: types.FailureType_Failure_UnexpectedMessage}
+	ErrButtonExpected    = &DeviceError{Code: types.FailureType_Failure_ButtonExpected}
+	ErrSyntaxError       = &DeviceError{Code: types.FailureType_Failure_SyntaxError}
+	ErrActionCancelled   = &DeviceError{Code: types.FailureType_Failure_ActionCancelled}
+	ErrPinExpected       = &DeviceError{Code: types.FailureType_Failure_PinExpected}
+	ErrPinCancelled      = &DeviceError{Code: types.FailureType_Failure_PinCancelled}
+	ErrPinInvalid        = &DeviceError{Code: types.FailureType_Failure_PinInvalid}
+	ErrInvalidSignature  = &DeviceError{Code: types.FailureType_Failure_InvalidSignature}
+	ErrOther             = &DeviceError{Code: types.FailureType_Failure_Other}
+	ErrNotEnoughFunds    = &DeviceError{Code: types.FailureType_Failure_NotEnoughFunds}
+	ErrNotInitialized    = &DeviceError{Code: types.FailureType_Failure_NotInitialized}
+	ErrFirmwareError     = &DeviceError{Code: types.FailureType_Failure_FirmwareError}
+)
+
+func newDeviceError(msg common.Failurer, request common.MessageType) *DeviceError {
+	return &DeviceError{
+		Code:    types.FailureTyper2Type(msg.GetCode()),
+		Message: msg.GetMessage(),
+		Request: request,
+	}
+}
+
+func (e *DeviceError) Error() string {
+	name, ok := types.FailureType_name[int32(e.Code)]
+	if ok {
+		name = strings.TrimPrefix(name, "FailureType_")
+	} else {
+		name = "Failure_" + strconv.Itoa(int(e.Code))
+	}
+	if e.Message == "" {
+		return name
+	}
+	return name + ": " + e.Message
+}
+
+// Is reports whether target is a DeviceError with the same failure code.
+func (e *DeviceError) Is(target error) bool {
+	t, ok := target.(*DeviceError)
+	return ok && t.Code == e.Code
+}
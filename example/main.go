@@ -17,7 +17,9 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/conejoninja/cerrojo"
+	"github.com/conejoninja/cerrojo/bitcoin/address"
 	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/hdkey"
 	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
 	"github.com/conejoninja/cerrojo/transport"
 	"github.com/zserge/hid"
@@ -44,7 +46,7 @@ func connect() int {
 	hid.UsbWalk(func(device hid.Device) {
 		info := device.Info()
 		for _, d := range devicesConf {
-			if info.Vendor == d.Info.Vendor && info.Product == d.Info.Product && info.Interface == d.Info.Interface {
+			if !d.Info.WebUSB && d.Info.Matches(info.Vendor, info.Product, info.Interface) {
 				numberDevices++
 				var t transport.TransportHID
 				t.SetDevice(device)
@@ -484,6 +486,41 @@ func shell() {
 				}
 			}
 			break
+		case "getaddresses":
+			var path string
+			count := 10
+			if len(args) < 2 {
+				path = "m/84'/0'/0'"
+			} else {
+				path = args[1]
+			}
+			if len(args) >= 3 {
+				count, _ = strconv.Atoi(args[2])
+			}
+
+			if !cerrojo.ValidBIP32(path) {
+				fmt.Println("Invalid BIP32 path. Example: m/84'/0'/0' ")
+			} else {
+				// one GetPublicKey for the account, the addresses are derived locally
+				account := cerrojo.StringToBIP32Path(path)
+				str, msgType = call(client.GetPublicKey(account))
+				var node trezor.PublicKey
+				err := json.Unmarshal([]byte(str), &node)
+				if err == nil {
+					var key *hdkey.Key
+					var addresses []string
+					key, err = hdkey.FromHDNode(node.GetNode(), hdkey.Xpub)
+					if err == nil {
+						addresses, err = key.Addresses(address.Bitcoin, cerrojo.ScriptTypeForPath(account), 0, 0, uint32(count))
+					}
+					if err == nil {
+						str = strings.Join(addresses, "\n")
+					} else {
+						str = err.Error()
+					}
+				}
+			}
+			break
 		case "signidentity":
 			var index uint32
 			if len(args) < 4 {
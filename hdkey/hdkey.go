@@ -0,0 +1,233 @@
+// Package hdkey derives BIP-32 public keys locally from the extended public
+// key of an account, so a watch-only wallet can generate its addresses
+// without asking the device for each one.
+package hdkey
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/conejoninja/cerrojo/bitcoin/address"
+	"github.com/conejoninja/cerrojo/bitcoin/script"
+	"github.com/conejoninja/cerrojo/pb/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Version bytes of extended public keys, SLIP-132 for the segwit ones.
+const (
+	Xpub uint32 = 0x0488b21e
+	Ypub uint32 = 0x049d7cb2
+	Zpub uint32 = 0x04b24746
+	Tpub uint32 = 0x043587cf
+	Upub uint32 = 0x044a5262
+	Vpub uint32 = 0x045f1cf6
+)
+
+// Hardened is the first hardened child index.
+const Hardened uint32 = 0x80000000
+
+var (
+	// ErrInvalidKey is returned for extended public keys that cannot be
+	// decoded.
+	ErrInvalidKey = errors.New("hdkey: invalid extended public key")
+	// ErrHardened is returned when deriving a hardened child, which needs
+	// the private key.
+	ErrHardened = errors.New("hdkey: cannot derive a hardened child from a public key")
+	// ErrInvalidChild is returned for the rare indexes without a valid key,
+	// BIP-32 has the caller skip to the next one.
+	ErrInvalidChild = errors.New("hdkey: invalid child")
+)
+
+// Key is a BIP-32 extended public key.
+type Key struct {
+	Version           uint32
+	Depth             uint8
+	ParentFingerprint uint32
+	ChildNum          uint32
+	ChainCode         []byte
+	PubKey            []byte
+}
+
+// Parse decodes a base58check extended public key. Any version bytes are
+// accepted, Version tells xpub, ypub, zpub and the others apart.
+func Parse(s string) (*Key, error) {
+	b, err := address.CheckDecode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if len(b) != 78 {
+		return nil, fmt.Errorf("%w: length %d", ErrInvalidKey, len(b))
+	}
+	k := &Key{
+		Version:           binary.BigEndian.Uint32(b[0:4]),
+		Depth:             b[4],
+		ParentFingerprint: binary.BigEndian.Uint32(b[5:9]),
+		ChildNum:          binary.BigEndian.Uint32(b[9:13]),
+		ChainCode:         b[13:45],
+		PubKey:            b[45:78],
+	}
+	if err = k.check(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// FromHDNode returns the key of the node of a PublicKey reply to
+// GetPublicKey, with the given version bytes.
+func FromHDNode(node types.HDNodeTyper, version uint32) (*Key, error) {
+	k := &Key{
+		Version:           version,
+		Depth:             uint8(node.GetDepth()),
+		ParentFingerprint: node.GetFingerprint(),
+		ChildNum:          node.GetChildNum(),
+		ChainCode:         node.GetChainCode(),
+		PubKey:            node.GetPublicKey(),
+	}
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Key) check() error {
+	if len(k.ChainCode) != 32 {
+		return fmt.Errorf("%w: chain code length %d", ErrInvalidKey, len(k.ChainCode))
+	}
+	if _, err := secp256k1.ParsePubKey(k.PubKey); err != nil || len(k.PubKey) != 33 {
+		return fmt.Errorf("%w: not a compressed public key", ErrInvalidKey)
+	}
+	return nil
+}
+
+// String returns the key serialized in base58check.
+func (k *Key) String() string {
+	b := make([]byte, 0, 78)
+	b = binary.BigEndian.AppendUint32(b, k.Version)
+	b = append(b, k.Depth)
+	b = binary.BigEndian.AppendUint32(b, k.ParentFingerprint)
+	b = binary.BigEndian.AppendUint32(b, k.ChildNum)
+	b = append(b, k.ChainCode...)
+	b = append(b, k.PubKey...)
+	return address.CheckEncode(b)
+}
+
+// WithVersion returns a copy of k with other version bytes, e.g. to turn an
+// xpub into the zpub of the same key.
+func (k *Key) WithVersion(version uint32) *Key {
+	c := *k
+	c.Version = version
+	return &c
+}
+
+// Fingerprint returns the fingerprint of k, the first 4 bytes of the hash
+// of its public key, as found in the ParentFingerprint of its children and
+// in PSBT derivations.
+func (k *Key) Fingerprint() uint32 {
+	return binary.BigEndian.Uint32(address.Hash160(k.PubKey)[:4])
+}
+
+// Child derives the non-hardened child i of k.
+func (k *Key) Child(i uint32) (*Key, error) {
+	if i >= Hardened {
+		return nil, ErrHardened
+	}
+	data := make([]byte, 37)
+	copy(data, k.PubKey)
+	binary.BigEndian.PutUint32(data[33:], i)
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	var tweak secp256k1.ModNScalar
+	if overflow := tweak.SetByteSlice(sum[:32]); overflow {
+		return nil, fmt.Errorf("%w %d", ErrInvalidChild, i)
+	}
+	parent, err := secp256k1.ParsePubKey(k.PubKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a compressed public key", ErrInvalidKey)
+	}
+	var p, t, r secp256k1.JacobianPoint
+	parent.AsJacobian(&p)
+	secp256k1.ScalarBaseMultNonConst(&tweak, &t)
+	secp256k1.AddNonConst(&p, &t, &r)
+	if (r.X.IsZero() && r.Y.IsZero()) || r.Z.IsZero() {
+		return nil, fmt.Errorf("%w %d", ErrInvalidChild, i)
+	}
+	r.ToAffine()
+
+	return &Key{
+		Version:           k.Version,
+		Depth:             k.Depth + 1,
+		ParentFingerprint: k.Fingerprint(),
+		ChildNum:          i,
+		ChainCode:         sum[32:],
+		PubKey:            secp256k1.NewPublicKey(&r.X, &r.Y).SerializeCompressed(),
+	}, nil
+}
+
+// Derive derives the non-hardened path from k.
+func (k *Key) Derive(path ...uint32) (*Key, error) {
+	var err error
+	for _, i := range path {
+		if k, err = k.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ScriptType returns the script type the version bytes of k stand for,
+// P2PKH for xpub, tpub and unknown versions.
+func (k *Key) ScriptType() script.Type {
+	switch k.Version {
+	case Ypub, Upub:
+		return script.P2SHP2WPKH
+	case Zpub, Vpub:
+		return script.P2WPKH
+	}
+	return script.P2PKH
+}
+
+// ScriptPubKey returns the output script paying to the public key of k.
+func (k *Key) ScriptPubKey(scriptType script.Type) []byte {
+	hash := address.Hash160(k.PubKey)
+	switch scriptType {
+	case script.P2SHP2WPKH:
+		return address.P2SH(address.Hash160(address.P2WPKH(hash)))
+	case script.P2WPKH:
+		return address.P2WPKH(hash)
+	}
+	return address.P2PKH(hash)
+}
+
+// Address returns the address of the public key of k.
+func (k *Key) Address(params address.Params, scriptType script.Type) (string, error) {
+	return address.FromScript(k.ScriptPubKey(scriptType), params)
+}
+
+// Addresses returns count addresses of the account k from index start of
+// the change branch, 0 for receive addresses and 1 for change ones.
+// Indexes without a valid key are left empty.
+func (k *Key) Addresses(params address.Params, scriptType script.Type, change, start, count uint32) ([]string, error) {
+	branch, err := k.Child(change)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, count)
+	for i := range addresses {
+		child, err := branch.Child(start + uint32(i))
+		if errors.Is(err, ErrInvalidChild) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if addresses[i], err = child.Address(params, scriptType); err != nil {
+			return nil, err
+		}
+	}
+	return addresses, nil
+}
@@ -0,0 +1,141 @@
+package hdkey
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/bitcoin/address"
+	"github.com/conejoninja/cerrojo/bitcoin/script"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/golang/protobuf/proto"
+)
+
+// the master public keys of the BIP-32 test vectors 1 and 2
+const (
+	vector1 = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	vector2 = "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"
+)
+
+func TestDerive(t *testing.T) {
+	for _, v := range []struct {
+		master string
+		path   []uint32
+		xpub   string
+	}{
+		{vector1, nil, vector1},
+		{vector1, []uint32{0}, "xpub68Gmy5EVb2BdFbj2LpWrk1M7obNuaPTpT5oh9QCCo5sRfqSHVYWex97WpDZzszdzHzxXDAzPLVSwybe4uPYkSk4G3gnrPqqkV9RyNzAcNJ1"},
+		{vector1, []uint32{0, 1}, "xpub6AvUGrnEpfvJBbfx7sQ89Q8hEMPM65UteqEX4yUbUiES2jHfjexmfJoxCGSwFMZiPBaKQT1RiKWrKfuDV4vpgVs4Xn8PpPTR2i79rwHd4Zr"},
+		{vector1, []uint32{0, 1, 2, 2, 1000000000}, "xpub6GX3zWVgSgPc5tgjE6ogT9nfwSADD3tdsxpzd7jJoJMqSY12Be6VQEFwDCp6wAQoZsH2iq5nNocHEaVDxBcobPrkZCjYW3QUmoDYzMFBDu9"},
+		{vector2, []uint32{0}, "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"},
+		{vector2, []uint32{0, 2147483647, 1, 2147483646}, "xpub6FL2423qFaWzHCvBndkN9cbkn5cysiUeFq4eb9t9kE88jcmY63tNuLNRzpHPdAM4dUpLhZ7aUm2cJ5zF7KYonf4jAPfRqTMTRBNkQL3Tfta"},
+	} {
+		master, err := Parse(v.master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := master.Derive(v.path...)
+		if err != nil || k.String() != v.xpub {
+			t.Errorf("%v: unexpected key %s %v", v.path, k, err)
+		}
+	}
+
+	master, _ := Parse(vector1)
+	if _, err := master.Child(Hardened); !errors.Is(err, ErrHardened) {
+		t.Errorf("expected ErrHardened, received %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	master, _ := Parse(vector1)
+	if master.Fingerprint() != 0x3442193e {
+		t.Errorf("unexpected fingerprint %08x", master.Fingerprint())
+	}
+	child, _ := master.Child(0)
+	if child.ParentFingerprint != master.Fingerprint() || child.Depth != 1 {
+		t.Errorf("unexpected child %+v", child)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"",
+		vector1[:len(vector1)-1] + "9",
+		address.CheckEncode(make([]byte, 77)),
+		// a public key not on the curve
+		address.CheckEncode(append(make([]byte, 45), append([]byte{0x02}, make([]byte, 32)...)...)),
+	} {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, received %v", s, err)
+		}
+	}
+
+	// the BIP-84 account of the "abandon ... about" mnemonic
+	zpub := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	k, err := Parse(zpub)
+	if err != nil || k.Version != Zpub || k.ScriptType() != script.P2WPKH || k.Depth != 3 || k.ChildNum != Hardened {
+		t.Fatalf("unexpected key %+v %v", k, err)
+	}
+	if back := k.WithVersion(Xpub).WithVersion(Zpub).String(); back != zpub || k.Version != Zpub {
+		t.Errorf("unexpected round trip %s", back)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	// BIP-84 and BIP-49 test vectors of the "abandon ... about" mnemonic
+	for _, v := range []struct {
+		account  string
+		params   address.Params
+		change   uint32
+		expected []string
+	}{
+		{
+			"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			address.Bitcoin, 0,
+			[]string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		},
+		{
+			"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			address.Bitcoin, 1,
+			[]string{"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		},
+		{
+			"upub5EFU65HtV5TeiSHmZZm7FUffBGy8UKeqp7vw43jYbvZPpoVsgU93oac7Wk3u6moKegAEWtGNF8DehrnHtv21XXEMYRUocHqguyjknFHYfgY",
+			address.Testnet, 0,
+			[]string{"2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		},
+	} {
+		account, err := Parse(v.account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses, err := account.Addresses(v.params, account.ScriptType(), v.change, 0, uint32(len(v.expected)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, addr := range addresses {
+			if addr != v.expected[i] {
+				t.Errorf("%d/%d: expected %s, received %s", v.change, i, v.expected[i], addr)
+			}
+		}
+	}
+}
+
+func TestFromHDNode(t *testing.T) {
+	k, _ := Parse(vector1)
+	child, _ := k.Child(7)
+	node := &trezortypes.HDNodeType{
+		Depth:       proto.Uint32(uint32(child.Depth)),
+		Fingerprint: proto.Uint32(child.ParentFingerprint),
+		ChildNum:    proto.Uint32(child.ChildNum),
+		ChainCode:   child.ChainCode,
+		PublicKey:   child.PubKey,
+	}
+	got, err := FromHDNode(node, Xpub)
+	if err != nil || got.String() != child.String() {
+		t.Errorf("unexpected key %s %v", got, err)
+	}
+	node.PublicKey = node.PublicKey[1:]
+	if _, err = FromHDNode(node, Xpub); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, received %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+// Package multisig describes m-of-n wallets made of the account xpubs of
+// their cosigners. It derives the wallet addresses locally, has a device
+// show them, and collects the signatures of several devices, one
+// cerrojo.Client each, into a finalized transaction.
+package multisig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/conejoninja/cerrojo"
+	"github.com/conejoninja/cerrojo/bitcoin/address"
+	"github.com/conejoninja/cerrojo/hdkey"
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// ScriptType is how the multisig script of a wallet is paid to.
+type ScriptType int
+
+const (
+	// P2SH pays to the script hash, legacy BIP-45/BIP-48 wallets.
+	P2SH ScriptType = iota
+	// P2SHP2WSH pays to a P2WSH program nested in P2SH.
+	P2SHP2WSH
+	// P2WSH pays to the witness script hash, native segwit.
+	P2WSH
+)
+
+// InputScriptType returns the script_type of inputs spending s.
+func (s ScriptType) InputScriptType() types.InputScriptType {
+	switch s {
+	case P2SHP2WSH:
+		return types.InputScriptType_SPENDP2SHWITNESS
+	case P2WSH:
+		return types.InputScriptType_SPENDWITNESS
+	}
+	return types.InputScriptType_SPENDMULTISIG
+}
+
+// OutputScriptType returns the script_type of change outputs paying to s.
+func (s ScriptType) OutputScriptType() types.OutputScriptType {
+	switch s {
+	case P2SHP2WSH:
+		return types.OutputScriptType_PAYTOP2SHWITNESS
+	case P2WSH:
+		return types.OutputScriptType_PAYTOWITNESS
+	}
+	return types.OutputScriptType_PAYTOMULTISIG
+}
+
+var (
+	// ErrThreshold is returned by New for thresholds out of 1 <= m <= n <= 15.
+	ErrThreshold = errors.New("multisig: invalid threshold")
+	// ErrAddressMismatch is returned by ShowAddress when the device shows
+	// another address than the one derived locally.
+	ErrAddressMismatch = errors.New("multisig: device address does not match")
+	// ErrNotEnoughSigners is returned by Sign when given less than m signers.
+	ErrNotEnoughSigners = errors.New("multisig: not enough signers")
+	// ErrDuplicateSigner is returned by Sign when two of the first m signers
+	// are the same cosigner.
+	ErrDuplicateSigner = errors.New("multisig: duplicate cosigner")
+)
+
+// Wallet is an m-of-n multisig wallet. Its addresses are at the
+// non-hardened change/index path below the account xpub of every cosigner.
+type Wallet struct {
+	M          int
+	ScriptType ScriptType
+	cosigners  []*hdkey.Key
+}
+
+// New returns the m-of-n wallet of the given cosigner account xpubs, the
+// order does not matter as public keys are sorted as in BIP-67. Invalid
+// xpubs are reported with hdkey.ErrInvalidKey.
+func New(m int, scriptType ScriptType, xpubs ...string) (*Wallet, error) {
+	if m < 1 || m > len(xpubs) || len(xpubs) > 15 {
+		return nil, fmt.Errorf("%w %d-of-%d", ErrThreshold, m, len(xpubs))
+	}
+	w := &Wallet{M: m, ScriptType: scriptType}
+	for _, xpub := range xpubs {
+		k, err := hdkey.Parse(xpub)
+		if err != nil {
+			return nil, err
+		}
+		w.cosigners = append(w.cosigners, k)
+	}
+	return w, nil
+}
+
+// N returns the number of cosigners.
+func (w *Wallet) N() int {
+	return len(w.cosigners)
+}
+
+// order returns the cosigner keys derived at change/index sorted as in
+// BIP-67, with the cosigner each one belongs to.
+func (w *Wallet) order(change, index uint32) ([]*hdkey.Key, []int, error) {
+	keys := make([]*hdkey.Key, len(w.cosigners))
+	cosigners := make([]int, len(w.cosigners))
+	for i, c := range w.cosigners {
+		k, err := c.Derive(change, index)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i], cosigners[i] = k, i
+	}
+	sort.Sort(byPubKey{keys, cosigners})
+	return keys, cosigners, nil
+}
+
+type byPubKey struct {
+	keys      []*hdkey.Key
+	cosigners []int
+}
+
+func (b byPubKey) Len() int { return len(b.keys) }
+func (b byPubKey) Less(i, j int) bool {
+	return bytes.Compare(b.keys[i].PubKey, b.keys[j].PubKey) < 0
+}
+func (b byPubKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.cosigners[i], b.cosigners[j] = b.cosigners[j], b.cosigners[i]
+}
+
+// PubKeys returns the public keys of the address at change/index, sorted.
+func (w *Wallet) PubKeys(change, index uint32) ([][]byte, error) {
+	keys, _, err := w.order(change, index)
+	if err != nil {
+		return nil, err
+	}
+	pubKeys := make([][]byte, len(keys))
+	for i, k := range keys {
+		pubKeys[i] = k.PubKey
+	}
+	return pubKeys, nil
+}
+
+// Script returns the m-of-n OP_CHECKMULTISIG script of pubKeys, in the
+// given order.
+func Script(m int, pubKeys [][]byte) []byte {
+	script := []byte{0x50 + byte(m)}
+	for _, k := range pubKeys {
+		script = append(script, byte(len(k)))
+		script = append(script, k...)
+	}
+	return append(script, 0x50+byte(len(pubKeys)), 0xae)
+}
+
+// Script returns the multisig script of the address at change/index, the
+// redeem script of P2SH wallets and the witness script of segwit ones.
+func (w *Wallet) Script(change, index uint32) ([]byte, error) {
+	pubKeys, err := w.PubKeys(change, index)
+	if err != nil {
+		return nil, err
+	}
+	return Script(w.M, pubKeys), nil
+}
+
+// ScriptPubKey returns the output script paying to the address at
+// change/index.
+func (w *Wallet) ScriptPubKey(change, index uint32) ([]byte, error) {
+	script, err := w.Script(change, index)
+	if err != nil {
+		return nil, err
+	}
+	witnessHash := sha256.Sum256(script)
+	switch w.ScriptType {
+	case P2WSH:
+		return address.P2WSH(witnessHash[:]), nil
+	case P2SHP2WSH:
+		return address.P2SH(address.Hash160(address.P2WSH(witnessHash[:]))), nil
+	}
+	return address.P2SH(address.Hash160(script)), nil
+}
+
+// Address returns the address at change/index.
+func (w *Wallet) Address(params address.Params, change, index uint32) (string, error) {
+	script, err := w.ScriptPubKey(change, index)
+	if err != nil {
+		return "", err
+	}
+	return address.FromScript(script, params)
+}
+
+// RedeemScriptType returns the wallet at change/index as the device expects
+// it: every cosigner account node with the change/index path below it, in
+// the order of their sorted public keys. signatures are the ones already
+// collected, in the same order and empty for missing ones, or nil.
+func (w *Wallet) RedeemScriptType(tp types.Typer, change, index uint32, signatures [][]byte) (types.MultisigRedeemScriptTyper, error) {
+	_, cosigners, err := w.order(change, index)
+	if err != nil {
+		return nil, err
+	}
+	ms := tp.GetMultisigRedeemScriptType()
+	var pubKeys []types.HDNodePathTyper
+	for _, i := range cosigners {
+		c := w.cosigners[i]
+		depth, fingerprint, childNum := uint32(c.Depth), c.ParentFingerprint, c.ChildNum
+		node := tp.GetHDNodeType()
+		node.SetDepth(&depth)
+		node.SetFingerprint(&fingerprint)
+		node.SetChildNum(&childNum)
+		node.SetChainCode(c.ChainCode)
+		node.SetPublicKey(c.PubKey)
+
+		pubKey := tp.GetHDNodePathType()
+		pubKey.SetNode(node)
+		pubKey.SetAddressN([]uint32{change, index})
+		pubKeys = append(pubKeys, pubKey)
+	}
+	ms.SetPubkeys(pubKeys)
+	if signatures != nil {
+		ms.SetSignatures(signatures)
+	}
+	m := uint32(w.M)
+	ms.SetM(&m)
+	return ms, nil
+}
+
+// ShowAddress has the device show the address at change/index and checks
+// it matches the one derived locally. account is the path of the device own
+// cosigner account, the one its xpub was exported from.
+func (w *Wallet) ShowAddress(ctx context.Context, c *cerrojo.Client, coin string, account []uint32, change, index uint32) (string, error) {
+	params, ok := address.ByCoin(coin)
+	if !ok {
+		return "", fmt.Errorf("multisig: unknown coin %q", coin)
+	}
+	expected, err := w.Address(params, change, index)
+	if err != nil {
+		return "", err
+	}
+	ms, err := w.RedeemScriptType(c.Types(), change, index, nil)
+	if err != nil {
+		return "", err
+	}
+	reply, msgType, err := c.CallContext(ctx, c.GetMultisigAddress(childPath(account, change, index), true, coin, ms, w.ScriptType.InputScriptType()))
+	if err != nil {
+		return "", err
+	}
+	if msgType != common.MessageType_value["MessageType_MessageType_Address"] {
+		return "", fmt.Errorf("multisig: unexpected %s", common.MessageType_name[msgType])
+	}
+	if got := reply.(common.Addresser).GetAddress(); got != expected {
+		return got, fmt.Errorf("%w: %s, expected %s", ErrAddressMismatch, got, expected)
+	}
+	return expected, nil
+}
+
+// Input spends output PrevIndex of the transaction PrevHash, in display
+// order, paying Amount to the wallet address at Change/Index.
+type Input struct {
+	PrevHash  []byte
+	PrevIndex uint32
+	Amount    uint64
+	Change    uint32
+	Index     uint32
+}
+
+// Output pays Amount to Address, or back to the wallet address at
+// Change/Index when Address is empty.
+type Output struct {
+	Address string
+	Amount  uint64
+	Change  uint32
+	Index   uint32
+}
+
+// Transaction is a transaction spending from the wallet.
+type Transaction struct {
+	Coin     string
+	Version  uint32
+	LockTime uint32
+	Inputs   []Input
+	Outputs  []Output
+}
+
+// Signer is a cosigner device: Account is the path of its cosigner account,
+// the one its xpub was exported from, and Cosigner the index of that xpub
+// in the ones given to New.
+type Signer struct {
+	Client   *cerrojo.Client
+	Account  []uint32
+	Cosigner int
+}
+
+// Sign has the first m signers sign tx in turn, each one given the
+// signatures of the previous ones, and returns the finalized raw
+// transaction serialized by the last one.
+func (w *Wallet) Sign(ctx context.Context, tx Transaction, signers []Signer, prevTxs cerrojo.PrevTxProvider) ([]byte, error) {
+	if len(signers) < w.M {
+		return nil, fmt.Errorf("%w: %d of %d", ErrNotEnoughSigners, len(signers), w.M)
+	}
+	seen := map[int]bool{}
+	for _, s := range signers[:w.M] {
+		if s.Cosigner < 0 || s.Cosigner >= w.N() {
+			return nil, fmt.Errorf("multisig: no cosigner %d", s.Cosigner)
+		}
+		if seen[s.Cosigner] {
+			return nil, fmt.Errorf("%w %d", ErrDuplicateSigner, s.Cosigner)
+		}
+		seen[s.Cosigner] = true
+	}
+	signatures := make([][][]byte, len(tx.Inputs))
+	for i := range signatures {
+		signatures[i] = make([][]byte, w.N())
+	}
+
+	var raw []byte
+	for _, s := range signers[:w.M] {
+		signTx, err := w.transaction(s, tx, signatures)
+		if err != nil {
+			return nil, err
+		}
+		var sigs [][]byte
+		if raw, sigs, err = s.Client.SignTransaction(ctx, signTx, prevTxs); err != nil {
+			return nil, fmt.Errorf("multisig: cosigner %d: %w", s.Cosigner, err)
+		}
+		for i, in := range tx.Inputs {
+			if sigs[i] == nil {
+				return nil, fmt.Errorf("multisig: cosigner %d did not sign input %d", s.Cosigner, i)
+			}
+			_, cosigners, _ := w.order(in.Change, in.Index)
+			for j, c := range cosigners {
+				if c == s.Cosigner {
+					signatures[i][j] = sigs[i]
+				}
+			}
+		}
+	}
+	return raw, nil
+}
+
+// transaction builds tx for the device of s with the signatures collected
+// so far.
+func (w *Wallet) transaction(s Signer, tx Transaction, signatures [][][]byte) (cerrojo.Transaction, error) {
+	tp := s.Client.Types()
+	signTx := cerrojo.Transaction{Coin: tx.Coin, Version: tx.Version, LockTime: tx.LockTime}
+	for i, in := range tx.Inputs {
+		ms, err := w.RedeemScriptType(tp, in.Change, in.Index, signatures[i])
+		if err != nil {
+			return cerrojo.Transaction{}, err
+		}
+		input := tp.GetTxInputType()
+		st := tp.GetInputScriptType()
+		types.SetEnum(st, int32(w.ScriptType.InputScriptType()))
+		input.SetScriptType(st)
+		input.SetAddressN(childPath(s.Account, in.Change, in.Index))
+		input.SetPrevHash(in.PrevHash)
+		input.SetPrevIndex(&in.PrevIndex)
+		input.SetAmount(&in.Amount)
+		input.SetMultisig(ms)
+		signTx.Inputs = append(signTx.Inputs, input)
+	}
+	for _, out := range tx.Outputs {
+		if out.Address != "" {
+			signTx.Outputs = append(signTx.Outputs, cerrojo.NewOutput(tp, out.Address, out.Amount))
+			continue
+		}
+		ms, err := w.RedeemScriptType(tp, out.Change, out.Index, nil)
+		if err != nil {
+			return cerrojo.Transaction{}, err
+		}
+		output := tp.GetTxOutputType()
+		st := tp.GetOutputScriptType()
+		types.SetEnum(st, int32(w.ScriptType.OutputScriptType()))
+		output.SetScriptType(st)
+		output.SetAddressN(childPath(s.Account, out.Change, out.Index))
+		output.SetAmount(&out.Amount)
+		output.SetMultisig(ms)
+		signTx.Outputs = append(signTx.Outputs, output)
+	}
+	return signTx, nil
+}
+
+func childPath(account []uint32, change, index uint32) []uint32 {
+	return append(append([]uint32{}, account...), change, index)
+}
@@ -0,0 +1,230 @@
+package multisig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/cerrojo"
+	"github.com/conejoninja/cerrojo/bitcoin/address"
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/hdkey"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+// the master xpubs of the BIP-32 test vectors 1 and 2, and the m/0 child of
+// the first one
+var xpubs = []string{
+	"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+	"xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB",
+	"xpub68Gmy5EVb2BdFbj2LpWrk1M7obNuaPTpT5oh9QCCo5sRfqSHVYWex97WpDZzszdzHzxXDAzPLVSwybe4uPYkSk4G3gnrPqqkV9RyNzAcNJ1",
+}
+
+// TestScript checks the 6-of-6 P2SH-P2WSH example of BIP-143.
+func TestScript(t *testing.T) {
+	var pubKeys [][]byte
+	for _, k := range []string{
+		"0307b8ae49ac90a048e9b53357a2354b3334e9c8bee813ecb98e99a7e07e8c3ba3",
+		"03b28f0c28bfab54554ae8c658ac5c3e0ce6e79ad336331f78c428dd43eea8449b",
+		"034b8113d703413d57761b8b9781957b8c0ac1dfe69f492580ca4195f50376ba4a",
+		"033400f6afecb833092a9a21cfdf1ed1376e58c5d1f47de74683123987e967a8f4",
+		"03a6d48b1131e94ba04d9737d61acdaa1322008af9602b3b14862c07a1789aac16",
+		"02d8b661b0b3302ee2f162b09e07a55ad5dfbe673a9f01d9f0c19617681024306b",
+	} {
+		b, _ := hex.DecodeString(k)
+		pubKeys = append(pubKeys, b)
+	}
+	script := Script(6, pubKeys)
+	witnessHash := sha256.Sum256(script)
+	if hex.EncodeToString(witnessHash[:]) != "a16b5755f7f6f96dbd65f5f0d6ab9418b89af4b1f14a1bb8a09062c35f0dcb54" {
+		t.Errorf("unexpected witness script %x", script)
+	}
+	if hex.EncodeToString(address.Hash160(address.P2WSH(witnessHash[:]))) != "9993a429037b5d912407a71c252019287b8d27a5" {
+		t.Error("unexpected P2SH-P2WSH script hash")
+	}
+}
+
+func TestWallet(t *testing.T) {
+	if _, err := New(3, P2WSH, xpubs[:2]...); !errors.Is(err, ErrThreshold) {
+		t.Errorf("expected ErrThreshold, received %v", err)
+	}
+	if _, err := New(1, P2WSH, xpubs[0][1:]); !errors.Is(err, hdkey.ErrInvalidKey) {
+		t.Errorf("expected hdkey.ErrInvalidKey, received %v", err)
+	}
+
+	addresses := map[string]bool{}
+	for scriptType, prefix := range map[ScriptType]string{P2SH: "3", P2SHP2WSH: "3", P2WSH: "bc1q"} {
+		w, err := New(2, scriptType, xpubs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := w.Address(address.Bitcoin, 0, 1)
+		if err != nil || !strings.HasPrefix(addr, prefix) || addresses[addr] {
+			t.Errorf("%d: unexpected address %s %v", scriptType, addr, err)
+		}
+		addresses[addr] = true
+
+		// the order of the cosigners does not matter
+		shuffled, _ := New(2, scriptType, xpubs[2], xpubs[0], xpubs[1])
+		if again, _ := shuffled.Address(address.Bitcoin, 0, 1); again != addr {
+			t.Errorf("%d: address %s depends on the cosigner order", scriptType, again)
+		}
+	}
+
+	w, _ := New(2, P2WSH, xpubs...)
+	pubKeys, err := w.PubKeys(0, 1)
+	if err != nil || len(pubKeys) != 3 {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(pubKeys); i++ {
+		if bytes.Compare(pubKeys[i-1], pubKeys[i]) >= 0 {
+			t.Errorf("public keys not sorted %x", pubKeys)
+		}
+	}
+	// m/0/1 of the first test vector
+	own, _ := hdkey.Parse("xpub6AvUGrnEpfvJBbfx7sQ89Q8hEMPM65UteqEX4yUbUiES2jHfjexmfJoxCGSwFMZiPBaKQT1RiKWrKfuDV4vpgVs4Xn8PpPTR2i79rwHd4Zr")
+	found := false
+	for _, k := range pubKeys {
+		found = found || bytes.Equal(k, own.PubKey)
+	}
+	if !found {
+		t.Error("expected the m/0/1 key of the first cosigner")
+	}
+
+	ms, err := w.RedeemScriptType(&trezortypes.Getter{}, 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.GetM() != 2 || len(ms.GetPubkeys()) != 3 {
+		t.Fatalf("unexpected redeem script %v", ms)
+	}
+	for i, p := range ms.GetPubkeys() {
+		node, err := hdkey.FromHDNode(p.GetNode(), hdkey.Xpub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		derived, _ := node.Derive(p.GetAddressN()...)
+		if !bytes.Equal(derived.PubKey, pubKeys[i]) {
+			t.Errorf("node %d does not derive the sorted key", i)
+		}
+	}
+}
+
+func mockClient() (*cerrojo.Client, *transport.Mock) {
+	d, _ := devices.GetDevice("trezor")
+	mock := transport.NewMock(d.Messages)
+	var c cerrojo.Client
+	c.SetTransport(mock, d)
+	return &c, mock
+}
+
+func TestShowAddress(t *testing.T) {
+	w, _ := New(2, P2SHP2WSH, xpubs...)
+	expected, _ := w.Address(address.Bitcoin, 0, 4)
+	account := cerrojo.StringToBIP32Path("m/48'/0'/0'/1'")
+
+	c, mock := mockClient()
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Address"], &trezor.Address{Address: proto.String(expected)})
+	addr, err := w.ShowAddress(context.Background(), c, "Bitcoin", account, 0, 4)
+	if err != nil || addr != expected {
+		t.Fatalf("unexpected address %s %v", addr, err)
+	}
+	written, err := mock.Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := written[0].(common.GetAddresser)
+	if !msg.GetShowDisplay() || len(msg.GetAddressN()) != 6 || msg.GetAddressN()[5] != 4 ||
+		types.InputScriptTyper2Type(msg.GetScriptType()) != types.InputScriptType_SPENDP2SHWITNESS ||
+		msg.GetMultisig().GetM() != 2 || len(msg.GetMultisig().GetPubkeys()) != 3 {
+		t.Errorf("unexpected GetAddress %v", msg)
+	}
+
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Address"], &trezor.Address{Address: proto.String("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")})
+	if _, err = w.ShowAddress(context.Background(), c, "Bitcoin", account, 0, 4); !errors.Is(err, ErrAddressMismatch) {
+		t.Errorf("expected ErrAddressMismatch, received %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	w, _ := New(2, P2WSH, xpubs...)
+	prevHash := bytes.Repeat([]byte{0xab}, 32)
+	tx := Transaction{
+		Coin:    "Bitcoin",
+		Version: 2,
+		Inputs:  []Input{{PrevHash: prevHash, PrevIndex: 1, Amount: 100000, Change: 0, Index: 1}},
+		Outputs: []Output{
+			{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Amount: 60000},
+			{Amount: 39000, Change: 1, Index: 0},
+		},
+	}
+
+	// each device asks for the input and the outputs, then signs
+	signatures := [][]byte{{0x30, 0x44, 0x01}, {0x30, 0x44, 0x02}}
+	finalized := []byte{0x02, 0x00, 0x00, 0x00}
+	var signers []Signer
+	var mocks []*transport.Mock
+	for i, cosigner := range []int{2, 0} {
+		c, mock := mockClient()
+		serialized := &trezortypes.TxRequestSerializedType{SignatureIndex: proto.Uint32(0), Signature: signatures[i]}
+		if i == 1 {
+			serialized.SerializedTx = finalized
+		}
+		for _, msg := range []*trezor.TxRequest{
+			{RequestType: trezortypes.RequestType_TXINPUT.Enum(), Details: &trezortypes.TxRequestDetailsType{RequestIndex: proto.Uint32(0)}},
+			{RequestType: trezortypes.RequestType_TXOUTPUT.Enum(), Details: &trezortypes.TxRequestDetailsType{RequestIndex: proto.Uint32(0)}},
+			{RequestType: trezortypes.RequestType_TXOUTPUT.Enum(), Details: &trezortypes.TxRequestDetailsType{RequestIndex: proto.Uint32(1)}},
+			{RequestType: trezortypes.RequestType_TXFINISHED.Enum(), Serialized: serialized},
+		} {
+			mock.Reply(common.MessageType_value["MessageType_MessageType_TxRequest"], msg)
+		}
+		signers = append(signers, Signer{Client: c, Account: cerrojo.StringToBIP32Path("m/48'/0'/0'/2'"), Cosigner: cosigner})
+		mocks = append(mocks, mock)
+	}
+
+	if _, err := w.Sign(context.Background(), tx, signers[:1], nil); !errors.Is(err, ErrNotEnoughSigners) {
+		t.Errorf("expected ErrNotEnoughSigners, received %v", err)
+	}
+	twice := []Signer{signers[0], signers[0]}
+	if _, err := w.Sign(context.Background(), tx, twice, nil); !errors.Is(err, ErrDuplicateSigner) {
+		t.Errorf("expected ErrDuplicateSigner, received %v", err)
+	}
+	raw, err := w.Sign(context.Background(), tx, signers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, finalized) {
+		t.Errorf("unexpected raw transaction %x", raw)
+	}
+
+	// the second device gets the signature of the first one, at the
+	// position of its key
+	_, cosigners, _ := w.order(0, 1)
+	written, err := mocks[1].Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := written[1].(common.TxAcker).GetTx().GetInputs()[0]
+	if types.InputScriptTyper2Type(input.GetScriptType()) != types.InputScriptType_SPENDWITNESS || input.GetAmount() != 100000 {
+		t.Errorf("unexpected input %v", input)
+	}
+	for j, sig := range input.GetMultisig().GetSignatures() {
+		if expected := cosigners[j] == 2; expected != bytes.Equal(sig, signatures[0]) {
+			t.Errorf("unexpected signature %d %x", j, sig)
+		}
+	}
+	change := written[3].(common.TxAcker).GetTx().GetOutputs()[0]
+	if types.OutputScriptTyper2Type(change.GetScriptType()) != types.OutputScriptType_PAYTOWITNESS ||
+		len(change.GetAddressN()) != 6 || change.GetAddressN()[4] != 1 || change.GetMultisig().GetM() != 2 {
+		t.Errorf("unexpected change output %v", change)
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// NewMessage returns an empty message of type msgType built by m, ready to be
+// unmarshalled into. It returns nil for unknown message types.
+func NewMessage(m Messager, msgType MessageType) proto.Message {
+	switch msgType {
+	case MessageType_value["MessageType_MessageType_Initialize"]:
+		return m.GetInitialize()
+	case MessageType_value["MessageType_MessageType_Ping"]:
+		return m.GetPing()
+	case MessageType_value["MessageType_MessageType_Success"]:
+		return m.GetSuccess()
+	case MessageType_value["MessageType_MessageType_Failure"]:
+		return m.GetFailure()
+	case MessageType_value["MessageType_MessageType_ChangePin"]:
+		return m.GetChangePin()
+	case MessageType_value["MessageType_MessageType_WipeDevice"]:
+		return m.GetWipeDevice()
+	case MessageType_value["MessageType_MessageType_FirmwareErase"]:
+		return m.GetFirmwareErase()
+	case MessageType_value["MessageType_MessageType_FirmwareUpload"]:
+		return m.GetFirmwareUpload()
+	case MessageType_value["MessageType_MessageType_FirmwareRequest"]:
+		return m.GetFirmwareRequest()
+	case MessageType_value["MessageType_MessageType_GetEntropy"]:
+		return m.GetGetEntropy()
+	case MessageType_value["MessageType_MessageType_Entropy"]:
+		return m.GetEntropy()
+	case MessageType_value["MessageType_MessageType_GetPublicKey"]:
+		return m.GetGetPublicKey()
+	case MessageType_value["MessageType_MessageType_PublicKey"]:
+		return m.GetPublicKey()
+	case MessageType_value["MessageType_MessageType_LoadDevice"]:
+		return m.GetLoadDevice()
+	case MessageType_value["MessageType_MessageType_ResetDevice"]:
+		return m.GetResetDevice()
+	case MessageType_value["MessageType_MessageType_SignTx"]:
+		return m.GetSignTx()
+	case MessageType_value["MessageType_MessageType_SimpleSignTx"]:
+		return m.GetSimpleSignTx()
+	case MessageType_value["MessageType_MessageType_Features"]:
+		return m.GetFeatures()
+	case MessageType_value["MessageType_MessageType_PinMatrixRequest"]:
+		return m.GetPinMatrixRequest()
+	case MessageType_value["MessageType_MessageType_PinMatrixAck"]:
+		return m.GetPinMatrixAck()
+	case MessageType_value["MessageType_MessageType_Cancel"]:
+		return m.GetCancel()
+	case MessageType_value["MessageType_MessageType_TxRequest"]:
+		return m.GetTxRequest()
+	case MessageType_value["MessageType_MessageType_TxAck"]:
+		return m.GetTxAck()
+	case MessageType_value["MessageType_MessageType_CipherKeyValue"]:
+		return m.GetCipherKeyValue()
+	case MessageType_value["MessageType_MessageType_ClearSession"]:
+		return m.GetClearSession()
+	case MessageType_value["MessageType_MessageType_ApplySettings"]:
+		return m.GetApplySettings()
+	case MessageType_value["MessageType_MessageType_ButtonRequest"]:
+		return m.GetButtonRequest()
+	case MessageType_value["MessageType_MessageType_ButtonAck"]:
+		return m.GetButtonAck()
+	case MessageType_value["MessageType_MessageType_GetAddress"]:
+		return m.GetGetAddress()
+	case MessageType_value["MessageType_MessageType_Address"]:
+		return m.GetAddress()
+	case MessageType_value["MessageType_MessageType_EntropyRequest"]:
+		return m.GetEntropyRequest()
+	case MessageType_value["MessageType_MessageType_EntropyAck"]:
+		return m.GetEntropyAck()
+	case MessageType_value["MessageType_MessageType_SignMessage"]:
+		return m.GetSignMessage()
+	case MessageType_value["MessageType_MessageType_VerifyMessage"]:
+		return m.GetVerifyMessage()
+	case MessageType_value["MessageType_MessageType_MessageSignature"]:
+		return m.GetMessageSignature()
+	case MessageType_value["MessageType_MessageType_PassphraseRequest"]:
+		return m.GetPassphraseRequest()
+	case MessageType_value["MessageType_MessageType_PassphraseAck"]:
+		return m.GetPassphraseAck()
+	case MessageType_value["MessageType_MessageType_EstimateTxSize"]:
+		return m.GetEstimateTxSize()
+	case MessageType_value["MessageType_MessageType_TxSize"]:
+		return m.GetTxSize()
+	case MessageType_value["MessageType_MessageType_RecoveryDevice"]:
+		return m.GetRecoveryDevice()
+	case MessageType_value["MessageType_MessageType_WordRequest"]:
+		return m.GetWordRequest()
+	case MessageType_value["MessageType_MessageType_WordAck"]:
+		return m.GetWordAck()
+	case MessageType_value["MessageType_MessageType_CipheredKeyValue"]:
+		return m.GetCipheredKeyValue()
+	case MessageType_value["MessageType_MessageType_EncryptMessage"]:
+		return m.GetEncryptMessage()
+	case MessageType_value["MessageType_MessageType_EncryptedMessage"]:
+		return m.GetEncryptedMessage()
+	case MessageType_value["MessageType_MessageType_DecryptMessage"]:
+		return m.GetDecryptMessage()
+	case MessageType_value["MessageType_MessageType_DecryptedMessage"]:
+		return m.GetDecryptedMessage()
+	case MessageType_value["MessageType_MessageType_SignIdentity"]:
+		return m.GetSignIdentity()
+	case MessageType_value["MessageType_MessageType_SignedIdentity"]:
+		return m.GetSignedIdentity()
+	case MessageType_value["MessageType_MessageType_GetFeatures"]:
+		return m.GetGetFeatures()
+	case MessageType_value["MessageType_MessageType_EthereumGetAddress"]:
+		return m.GetEthereumGetAddress()
+	case MessageType_value["MessageType_MessageType_EthereumAddress"]:
+		return m.GetEthereumAddress()
+	case MessageType_value["MessageType_MessageType_EthereumSignTx"]:
+		return m.GetEthereumSignTx()
+	case MessageType_value["MessageType_MessageType_EthereumTxRequest"]:
+		return m.GetEthereumTxRequest()
+	case MessageType_value["MessageType_MessageType_EthereumTxAck"]:
+		return m.GetEthereumTxAck()
+	case MessageType_value["MessageType_MessageType_GetECDHSessionKey"]:
+		return m.GetGetECDHSessionKey()
+	case MessageType_value["MessageType_MessageType_ECDHSessionKey"]:
+		return m.GetECDHSessionKey()
+	case MessageType_value["FCounter"]:
+		return m.GetSetU2FCounter()
+	case MessageType_value["MessageType_MessageType_CharacterRequest"]:
+		return m.GetCharacterRequest()
+	case MessageType_value["MessageType_MessageType_CharacterAck"]:
+		return m.GetCharacterAck()
+	case MessageType_value["MessageType_MessageType_RawTxAck"]:
+		return m.GetRawTxAck()
+	case MessageType_value["MessageType_MessageType_ApplyPolicies"]:
+		return m.GetApplyPolicies()
+	case MessageType_value["MessageType_MessageType_DebugLinkDecision"]:
+		return m.GetDebugLinkDecision()
+	case MessageType_value["MessageType_MessageType_DebugLinkGetState"]:
+		return m.GetDebugLinkGetState()
+	case MessageType_value["MessageType_MessageType_DebugLinkState"]:
+		return m.GetDebugLinkState()
+	case MessageType_value["MessageType_MessageType_DebugLinkStop"]:
+		return m.GetDebugLinkStop()
+	case MessageType_value["MessageType_MessageType_DebugLinkLog"]:
+		return m.GetDebugLinkLog()
+	case MessageType_value["MessageType_MessageType_DebugLinkFillConfig"]:
+		return m.GetDebugLinkFillConfig()
+	case MessageType_value["MessageType_MessageType_DebugLinkMemoryRead"]:
+		return m.GetDebugLinkMemoryRead()
+	case MessageType_value["MessageType_MessageType_DebugLinkMemory"]:
+		return m.GetDebugLinkMemory()
+	case MessageType_value["MessageType_MessageType_DebugLinkMemoryWrite"]:
+		return m.GetDebugLinkMemoryWrite()
+	case MessageType_value["MessageType_MessageType_DebugLinkFlashErase"]:
+		return m.GetDebugLinkFlashErase()
+	}
+	return nil
+}
@@ -28,7 +28,6 @@ package types
 
 import (
 	fmt "fmt"
-	"strconv"
 
 	proto "github.com/golang/protobuf/proto"
 
@@ -2092,43 +2091,29 @@ func TxRequestDetailsTyper2Type(x types.TxRequestDetailsTyper) TxRequestDetailsT
 }
 
 func OutputAddressTyper2Type(x types.OutputAddressTyper) OutputAddressType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return OutputAddressType(int32(tmp))
+	return OutputAddressType(types.OutputAddressTyper2Type(x))
 }
 
 func ButtonRequestTyper2Type(x types.ButtonRequestTyper) ButtonRequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return ButtonRequestType(int32(tmp))
+	return ButtonRequestType(types.ButtonRequestTyper2Type(x))
 }
 
 func PinMatrixRequestTyper2Type(x types.PinMatrixRequestTyper) PinMatrixRequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return PinMatrixRequestType(int32(tmp))
+	return PinMatrixRequestType(types.PinMatrixRequestTyper2Type(x))
 }
 
 func FailureTyper2Type(x types.FailureTyper) FailureType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return FailureType(int32(tmp))
+	return FailureType(types.FailureTyper2Type(x))
 }
 
 func OutputScriptTyper2Type(x types.OutputScriptTyper) OutputScriptType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return OutputScriptType(int32(tmp))
+	return OutputScriptType(types.OutputScriptTyper2Type(x))
 }
 
 func InputScriptTyper2Type(x types.InputScriptTyper) InputScriptType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return InputScriptType(int32(tmp))
+	return InputScriptType(types.InputScriptTyper2Type(x))
 }
 
 func RequestTyper2Type(x types.RequestTyper) RequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return RequestType(int32(tmp))
+	return RequestType(types.RequestTyper2Type(x))
 }
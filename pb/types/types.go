@@ -1,9 +1,12 @@
 package types
 
 import (
+	"reflect"
 	"strconv"
 
 	"github.com/conejoninja/cerrojo/pb/exchange"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type InputScriptTyper interface {
@@ -422,71 +425,133 @@ var OutputAddressType_value = map[string]int32{
 type OutputAddressType int32
 
 func OutputAddressTyper2Type(x OutputAddressTyper) OutputAddressType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return OutputAddressType(int32(tmp))
+	return OutputAddressType(enumValue(x))
 }
 
 type FailureType int32
 
+const (
+	FailureType_Failure_UnexpectedMessage FailureType = 1
+	FailureType_Failure_ButtonExpected    FailureType = 2
+	FailureType_Failure_SyntaxError       FailureType = 3
+	FailureType_Failure_ActionCancelled   FailureType = 4
+	FailureType_Failure_PinExpected       FailureType = 5
+	FailureType_Failure_PinCancelled      FailureType = 6
+	FailureType_Failure_PinInvalid        FailureType = 7
+	FailureType_Failure_InvalidSignature  FailureType = 8
+	FailureType_Failure_Other             FailureType = 9
+	FailureType_Failure_NotEnoughFunds    FailureType = 10
+	FailureType_Failure_NotInitialized    FailureType = 11
+	FailureType_Failure_FirmwareError     FailureType = 99
+)
+
 func FailureTyper2Type(x FailureTyper) FailureType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return FailureType(int32(tmp))
+	return FailureType(enumValue(x))
 }
 
 type OutputScriptType int32
 
+const (
+	OutputScriptType_PAYTOADDRESS     OutputScriptType = 0
+	OutputScriptType_PAYTOSCRIPTHASH  OutputScriptType = 1
+	OutputScriptType_PAYTOMULTISIG    OutputScriptType = 2
+	OutputScriptType_PAYTOOPRETURN    OutputScriptType = 3
+	OutputScriptType_PAYTOWITNESS     OutputScriptType = 4
+	OutputScriptType_PAYTOP2SHWITNESS OutputScriptType = 5
+)
+
 func OutputScriptTyper2Type(x OutputScriptTyper) OutputScriptType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return OutputScriptType(int32(tmp))
+	return OutputScriptType(enumValue(x))
 }
 
 type InputScriptType int32
 
+const (
+	InputScriptType_SPENDADDRESS     InputScriptType = 0
+	InputScriptType_SPENDMULTISIG    InputScriptType = 1
+	InputScriptType_EXTERNAL         InputScriptType = 2
+	InputScriptType_SPENDWITNESS     InputScriptType = 3
+	InputScriptType_SPENDP2SHWITNESS InputScriptType = 4
+)
+
 func InputScriptTyper2Type(x InputScriptTyper) InputScriptType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return InputScriptType(int32(tmp))
+	return InputScriptType(enumValue(x))
 }
 
 type ButtonRequestType int32
 
 func ButtonRequestTyper2Type(x ButtonRequestTyper) ButtonRequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return ButtonRequestType(int32(tmp))
+	return ButtonRequestType(enumValue(x))
 }
 
 type PinMatrixRequestType int32
 
+const (
+	PinMatrixRequestType_PinMatrixRequestType_Current   PinMatrixRequestType = 1
+	PinMatrixRequestType_PinMatrixRequestType_NewFirst  PinMatrixRequestType = 2
+	PinMatrixRequestType_PinMatrixRequestType_NewSecond PinMatrixRequestType = 3
+)
+
 func PinMatrixRequestTyper2Type(x PinMatrixRequestTyper) PinMatrixRequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return PinMatrixRequestType(int32(tmp))
+	return PinMatrixRequestType(enumValue(x))
 }
 
 type RecoveryDeviceType int32
 
 func RecoveryDeviceTyper2Type(x RecoveryDeviceTyper) RecoveryDeviceType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return RecoveryDeviceType(int32(tmp))
+	return RecoveryDeviceType(enumValue(x))
 }
 
 type WordRequestType int32
 
 func WordRequestTyper2Type(x WordRequestTyper) WordRequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return WordRequestType(int32(tmp))
+	return WordRequestType(enumValue(x))
 }
 
 type RequestType int32
 
+const (
+	RequestType_TXINPUT     RequestType = 0
+	RequestType_TXOUTPUT    RequestType = 1
+	RequestType_TXMETA      RequestType = 2
+	RequestType_TXFINISHED  RequestType = 3
+	RequestType_TXEXTRADATA RequestType = 4
+)
+
 func RequestTyper2Type(x RequestTyper) RequestType {
-	value := (x).String()
-	tmp, _ := strconv.Atoi(value)
-	return RequestType(int32(tmp))
+	return RequestType(enumValue(x))
+}
+
+// enumValue returns the numeric value of a generated enum, as their String()
+// returns the enum name instead. The enum Typer2Type functions of the device
+// profiles convert through the ones here for the same reason.
+func enumValue(x interface{}) int32 {
+	v := reflect.Indirect(reflect.ValueOf(x))
+	if !v.IsValid() {
+		return 0
+	}
+	return int32(v.Int())
+}
+
+// SetEnum sets a generated enum of a device profile from its value, as in
+// SetEnum(tp.GetInputScriptType(), int32(InputScriptType_SPENDWITNESS)).
+func SetEnum(x interface{ UnmarshalJSON([]byte) error }, value int32) {
+	x.UnmarshalJSON([]byte(strconv.Itoa(int(value))))
+}
+
+// SetMessages sets the message field name of m to msgs as they are, appending
+// them when the field is repeated. The generated setters convert messages
+// through the Typer2Type functions, which set every optional field, and the
+// device refuses some of them when empty, like the multisig of an input.
+func SetMessages(m proto.Message, name string, msgs ...proto.Message) {
+	r := proto.MessageReflect(m)
+	fd := r.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if !fd.IsList() {
+		r.Set(fd, protoreflect.ValueOfMessage(proto.MessageReflect(msgs[0])))
+		return
+	}
+	list := r.Mutable(fd).List()
+	for _, msg := range msgs {
+		list.Append(protoreflect.ValueOfMessage(proto.MessageReflect(msg)))
+	}
 }
@@ -0,0 +1,76 @@
+package prevtx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BitcoinCore fetches transactions from a Bitcoin Core node with the
+// getrawtransaction JSON-RPC call. The node needs -txindex to find
+// transactions outside its mempool and wallet. Coin is ignored, the node
+// serves a single network.
+type BitcoinCore struct {
+	URL      string
+	User     string
+	Password string
+	Client   *http.Client
+}
+
+type coreRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type coreResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+func (b *BitcoinCore) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	if err := checkTxID(txid); err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(coreRequest{JSONRPC: "1.0", ID: "cerrojo", Method: "getrawtransaction", Params: []interface{}{txid}})
+	req, err := http.NewRequestWithContext(ctx, "POST", b.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.User != "" || b.Password != "" {
+		req.SetBasicAuth(b.User, b.Password)
+	}
+
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: %w", err)
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: %w", err)
+	}
+
+	// errors come with a 404 or 500 status and a JSON body
+	var r coreResponse
+	if err = json.Unmarshal(reply, &r); err != nil {
+		return nil, fmt.Errorf("prevtx: getrawtransaction: %s", resp.Status)
+	}
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	var s string
+	if err = json.Unmarshal(r.Result, &s); err != nil {
+		return nil, fmt.Errorf("prevtx: transaction %s: %w", txid, err)
+	}
+	return decodeHex(txid, s)
+}
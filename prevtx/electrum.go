@@ -0,0 +1,120 @@
+package prevtx
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ElectrumProtocol is the protocol version negotiated with Electrum servers.
+const ElectrumProtocol = "1.4"
+
+// Electrum fetches transactions from an Electrum server with
+// blockchain.transaction.get. Addr is host:port, TLS is used when not nil.
+// Coin is ignored, the server serves a single network.
+type Electrum struct {
+	Addr    string
+	TLS     *tls.Config
+	Timeout time.Duration
+}
+
+type electrumRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type electrumResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// RPCError is an error returned by an Electrum server or a Bitcoin Core node.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("prevtx: rpc error %d: %s", e.Code, e.Message)
+}
+
+func (e *Electrum) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	if err := checkTxID(txid); err != nil {
+		return nil, err
+	}
+	conn, err := e.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if e.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(e.Timeout))
+	}
+	// a cancelled context unblocks the exchange by closing the connection
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c := &electrumConn{conn: conn, r: bufio.NewReader(conn)}
+	if _, err = c.call("server.version", "cerrojo", ElectrumProtocol); err != nil {
+		return nil, err
+	}
+	result, err := c.call("blockchain.transaction.get", txid)
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err = json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("prevtx: transaction %s: %w", txid, err)
+	}
+	return decodeHex(txid, s)
+}
+
+func (e *Electrum) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: e.Timeout}
+	if e.TLS == nil {
+		return d.DialContext(ctx, "tcp", e.Addr)
+	}
+	return (&tls.Dialer{NetDialer: d, Config: e.TLS}).DialContext(ctx, "tcp", e.Addr)
+}
+
+// electrumConn exchanges newline delimited JSON-RPC messages.
+type electrumConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	lastID int
+}
+
+func (c *electrumConn) call(method string, params ...interface{}) (json.RawMessage, error) {
+	c.lastID++
+	req, _ := json.Marshal(electrumRequest{JSONRPC: "2.0", ID: c.lastID, Method: method, Params: params})
+	if _, err := c.conn.Write(append(req, '\n')); err != nil {
+		return nil, fmt.Errorf("prevtx: %s: %w", method, err)
+	}
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("prevtx: %s: %w", method, err)
+		}
+		var resp electrumResponse
+		if err = json.Unmarshal(line, &resp); err != nil {
+			return nil, fmt.Errorf("prevtx: %s: %w", method, err)
+		}
+		// skip notifications and stale replies
+		if resp.ID != c.lastID {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	}
+}
@@ -0,0 +1,49 @@
+// Package prevtx implements cerrojo.PrevTxProvider backends to fetch the
+// previous transactions a device asks for while signing: a directory of hex
+// files, an Electrum server and a Bitcoin Core node.
+package prevtx
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidTxID is returned for txids that are not 64 hex characters.
+var ErrInvalidTxID = errors.New("prevtx: invalid txid")
+
+// Dir serves transactions from a directory holding one <txid>.hex file per
+// transaction, with the raw transaction in hex. Coin is ignored, use one
+// directory per coin.
+type Dir string
+
+func (d Dir) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	if err := checkTxID(txid); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(string(d), txid+".hex"))
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: %w", err)
+	}
+	return decodeHex(txid, string(b))
+}
+
+// checkTxID keeps txids from reaching paths and requests unchecked.
+func checkTxID(txid string) error {
+	if b, err := hex.DecodeString(txid); err != nil || len(b) != 32 {
+		return fmt.Errorf("%w %q", ErrInvalidTxID, txid)
+	}
+	return nil
+}
+
+func decodeHex(txid, s string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("prevtx: transaction %s: %w", txid, err)
+	}
+	return raw, nil
+}
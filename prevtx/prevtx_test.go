@@ -0,0 +1,172 @@
+package prevtx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conejoninja/cerrojo"
+)
+
+const (
+	txid    = "e47b5b7a879f13a8213815cf3dc3f5b35af1e217f412829bc4f75a8ca04909ab"
+	unknown = "0000000000000000000000000000000000000000000000000000000000000001"
+	rawHex  = "0200000001268171371edff285e937adeea4b37b78000c0566cbb3ad64641713ca42171bf60000000000feffffff"
+)
+
+var (
+	raw = []byte{0x02, 0x00, 0x00, 0x00, 0x01}
+
+	_ = []cerrojo.PrevTxProvider{Dir(""), &Electrum{}, &BitcoinCore{}}
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, txid+".hex"), []byte(rawHex+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Dir(dir).GetTx(context.Background(), "Bitcoin", txid)
+	if err != nil || !bytes.HasPrefix(got, raw) {
+		t.Fatalf("unexpected transaction %x %v", got, err)
+	}
+	if _, err = Dir(dir).GetTx(context.Background(), "Bitcoin", unknown); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, received %v", err)
+	}
+	if _, err = Dir(dir).GetTx(context.Background(), "Bitcoin", "../"+txid); !errors.Is(err, ErrInvalidTxID) {
+		t.Errorf("expected ErrInvalidTxID, received %v", err)
+	}
+}
+
+// electrumServer stands in for an Electrum server knowing a single
+// transaction, it checks the protocol version is negotiated first.
+func electrumServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				negotiated := false
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					var req electrumRequest
+					json.Unmarshal(line, &req)
+					resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+					switch {
+					case req.Method == "server.version":
+						negotiated = true
+						resp["result"] = []string{"ElectrumX 1.16.0", ElectrumProtocol}
+						// a notification the client must skip
+						conn.Write([]byte(`{"jsonrpc":"2.0","method":"blockchain.headers.subscribe","params":[]}` + "\n"))
+					case !negotiated:
+						resp["error"] = map[string]interface{}{"code": -32600, "message": "server.version first"}
+					case req.Method == "blockchain.transaction.get" && req.Params[0] == txid:
+						resp["result"] = rawHex
+					default:
+						resp["error"] = map[string]interface{}{"code": 2, "message": "daemon error: No such mempool or blockchain transaction."}
+					}
+					b, _ := json.Marshal(resp)
+					conn.Write(append(b, '\n'))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestElectrum(t *testing.T) {
+	e := &Electrum{Addr: electrumServer(t), Timeout: 5 * time.Second}
+	got, err := e.GetTx(context.Background(), "Bitcoin", txid)
+	if err != nil || !bytes.HasPrefix(got, raw) {
+		t.Fatalf("unexpected transaction %x %v", got, err)
+	}
+	var rpcErr *RPCError
+	if _, err = e.GetTx(context.Background(), "Bitcoin", unknown); !errors.As(err, &rpcErr) || rpcErr.Code != 2 {
+		t.Errorf("expected an rpc error, received %v", err)
+	}
+}
+
+func TestElectrumCancel(t *testing.T) {
+	// a server that never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err = (&Electrum{Addr: l.Addr().String()}).GetTx(ctx, "Bitcoin", txid); err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected the call to stop with the context, received %v after %s", err, time.Since(start))
+	}
+}
+
+// bitcoind stands in for a Bitcoin Core node knowing a single transaction.
+func bitcoind(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "rpc" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req coreRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method != "getrawtransaction" || len(req.Params) != 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Params[0] != txid {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"result":null,"error":{"code":-5,"message":"No such mempool or blockchain transaction. Use gettransaction for wallet transactions."},"id":"cerrojo"}`))
+			return
+		}
+		w.Write([]byte(`{"result":"` + rawHex + `","error":null,"id":"cerrojo"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBitcoinCore(t *testing.T) {
+	server := bitcoind(t)
+	core := &BitcoinCore{URL: server.URL, User: "rpc", Password: "secret"}
+	got, err := core.GetTx(context.Background(), "Bitcoin", txid)
+	if err != nil || !bytes.HasPrefix(got, raw) {
+		t.Fatalf("unexpected transaction %x %v", got, err)
+	}
+	var rpcErr *RPCError
+	if _, err = core.GetTx(context.Background(), "Bitcoin", unknown); !errors.As(err, &rpcErr) || rpcErr.Code != -5 {
+		t.Errorf("expected an rpc error, received %v", err)
+	}
+	core.Password = "wrong"
+	if _, err = core.GetTx(context.Background(), "Bitcoin", txid); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an authentication error, received %v", err)
+	}
+}
@@ -0,0 +1,403 @@
+// Package psbt reads and writes BIP-174 Partially Signed Bitcoin Transactions
+// (version 0) and signs them with a cerrojo Client.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	btctx "github.com/conejoninja/cerrojo/bitcoin/tx"
+)
+
+// Magic starts every PSBT.
+var Magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+const (
+	globalUnsignedTx = 0x00
+
+	inputNonWitnessUtxo     = 0x00
+	inputWitnessUtxo        = 0x01
+	inputPartialSig         = 0x02
+	inputSighashType        = 0x03
+	inputRedeemScript       = 0x04
+	inputWitnessScript      = 0x05
+	inputBIP32Derivation    = 0x06
+	inputFinalScriptSig     = 0x07
+	inputFinalScriptWitness = 0x08
+
+	outputRedeemScript    = 0x00
+	outputWitnessScript   = 0x01
+	outputBIP32Derivation = 0x02
+)
+
+var (
+	// ErrMagic is returned when the data does not start with Magic.
+	ErrMagic = errors.New("psbt: missing magic bytes")
+	// ErrNoUnsignedTx is returned when the global map has no transaction.
+	ErrNoUnsignedTx = errors.New("psbt: missing unsigned transaction")
+)
+
+// Packet is a parsed PSBT. UnsignedTx is the raw transaction being signed,
+// in the legacy serialization and with empty scriptSigs, there is one Input
+// and one Output for each of its inputs and outputs.
+type Packet struct {
+	UnsignedTx []byte
+	Inputs     []Input
+	Outputs    []Output
+	Unknown    []Record
+}
+
+// Record is a key-value pair cerrojo does not interpret, kept as is.
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// Derivation is the BIP-32 path of PubKey from the master key with
+// Fingerprint.
+type Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// PartialSig is a signature for PubKey, DER-encoded with the sighash type
+// byte appended.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+type Input struct {
+	NonWitnessUtxo     []byte
+	WitnessUtxo        *btctx.Output
+	PartialSigs        []PartialSig
+	SighashType        *uint32
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Derivations        []Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness []byte
+	Unknown            []Record
+}
+
+type Output struct {
+	RedeemScript  []byte
+	WitnessScript []byte
+	Derivations   []Derivation
+	Unknown       []Record
+}
+
+// Parse decodes a binary PSBT.
+func Parse(b []byte) (*Packet, error) {
+	if !bytes.HasPrefix(b, Magic) {
+		return nil, ErrMagic
+	}
+	r := bytes.NewReader(b[len(Magic):])
+
+	p := &Packet{}
+	records, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		switch rec.Key[0] {
+		case globalUnsignedTx:
+			if len(rec.Key) != 1 {
+				return nil, keyError("global", rec)
+			}
+			p.UnsignedTx = rec.Value
+		default:
+			p.Unknown = append(p.Unknown, rec)
+		}
+	}
+	if p.UnsignedTx == nil {
+		return nil, ErrNoUnsignedTx
+	}
+	tx, err := btctx.ParseLegacy(p.UnsignedTx)
+	if err != nil {
+		return nil, fmt.Errorf("psbt: unsigned transaction: %w", err)
+	}
+	for i, in := range tx.Inputs {
+		if len(in.ScriptSig) > 0 {
+			return nil, fmt.Errorf("psbt: unsigned transaction input %d has a scriptSig", i)
+		}
+	}
+
+	p.Inputs = make([]Input, len(tx.Inputs))
+	for i := range p.Inputs {
+		if records, err = readMap(r); err != nil {
+			return nil, fmt.Errorf("psbt: input %d: %w", i, err)
+		}
+		if err = p.Inputs[i].parse(records); err != nil {
+			return nil, fmt.Errorf("psbt: input %d: %w", i, err)
+		}
+	}
+	p.Outputs = make([]Output, len(tx.Outputs))
+	for i := range p.Outputs {
+		if records, err = readMap(r); err != nil {
+			return nil, fmt.Errorf("psbt: output %d: %w", i, err)
+		}
+		if err = p.Outputs[i].parse(records); err != nil {
+			return nil, fmt.Errorf("psbt: output %d: %w", i, err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("psbt: trailing data")
+	}
+	return p, nil
+}
+
+// ParseBase64 decodes a base64 PSBT, the usual way to exchange them.
+func ParseBase64(s string) (*Packet, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+func (in *Input) parse(records []Record) error {
+	for _, rec := range records {
+		single := len(rec.Key) == 1
+		switch rec.Key[0] {
+		case inputNonWitnessUtxo:
+			if !single {
+				return keyError("non-witness utxo", rec)
+			}
+			if _, err := btctx.Parse(rec.Value); err != nil {
+				return fmt.Errorf("non-witness utxo: %w", err)
+			}
+			in.NonWitnessUtxo = rec.Value
+		case inputWitnessUtxo:
+			if !single {
+				return keyError("witness utxo", rec)
+			}
+			out, err := parseTxOut(rec.Value)
+			if err != nil {
+				return fmt.Errorf("witness utxo: %w", err)
+			}
+			in.WitnessUtxo = out
+		case inputPartialSig:
+			if !validPubKey(rec.Key[1:]) {
+				return keyError("partial signature", rec)
+			}
+			in.PartialSigs = append(in.PartialSigs, PartialSig{PubKey: rec.Key[1:], Signature: rec.Value})
+		case inputSighashType:
+			if !single || len(rec.Value) != 4 {
+				return keyError("sighash type", rec)
+			}
+			sighash := binary.LittleEndian.Uint32(rec.Value)
+			in.SighashType = &sighash
+		case inputRedeemScript:
+			if !single {
+				return keyError("redeem script", rec)
+			}
+			in.RedeemScript = rec.Value
+		case inputWitnessScript:
+			if !single {
+				return keyError("witness script", rec)
+			}
+			in.WitnessScript = rec.Value
+		case inputBIP32Derivation:
+			d, err := parseDerivation(rec)
+			if err != nil {
+				return err
+			}
+			in.Derivations = append(in.Derivations, d)
+		case inputFinalScriptSig:
+			if !single {
+				return keyError("final scriptSig", rec)
+			}
+			in.FinalScriptSig = rec.Value
+		case inputFinalScriptWitness:
+			if !single {
+				return keyError("final script witness", rec)
+			}
+			in.FinalScriptWitness = rec.Value
+		default:
+			in.Unknown = append(in.Unknown, rec)
+		}
+	}
+	return nil
+}
+
+func (out *Output) parse(records []Record) error {
+	for _, rec := range records {
+		single := len(rec.Key) == 1
+		switch rec.Key[0] {
+		case outputRedeemScript:
+			if !single {
+				return keyError("redeem script", rec)
+			}
+			out.RedeemScript = rec.Value
+		case outputWitnessScript:
+			if !single {
+				return keyError("witness script", rec)
+			}
+			out.WitnessScript = rec.Value
+		case outputBIP32Derivation:
+			d, err := parseDerivation(rec)
+			if err != nil {
+				return err
+			}
+			out.Derivations = append(out.Derivations, d)
+		default:
+			out.Unknown = append(out.Unknown, rec)
+		}
+	}
+	return nil
+}
+
+func parseDerivation(rec Record) (Derivation, error) {
+	if !validPubKey(rec.Key[1:]) || len(rec.Value) < 4 || len(rec.Value)%4 != 0 {
+		return Derivation{}, keyError("BIP-32 derivation", rec)
+	}
+	d := Derivation{
+		PubKey:      rec.Key[1:],
+		Fingerprint: binary.BigEndian.Uint32(rec.Value[:4]),
+		Path:        make([]uint32, len(rec.Value)/4-1),
+	}
+	for i := range d.Path {
+		d.Path[i] = binary.LittleEndian.Uint32(rec.Value[4+4*i:])
+	}
+	return d, nil
+}
+
+func parseTxOut(b []byte) (*btctx.Output, error) {
+	r := bytes.NewReader(b)
+	out := &btctx.Output{}
+	if err := binary.Read(r, binary.LittleEndian, &out.Amount); err != nil {
+		return nil, err
+	}
+	script, err := btctx.ReadVarBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+	out.Script = script
+	return out, nil
+}
+
+func validPubKey(key []byte) bool {
+	return (len(key) == 33 && (key[0] == 2 || key[0] == 3)) || (len(key) == 65 && key[0] == 4)
+}
+
+func keyError(field string, rec Record) error {
+	return fmt.Errorf("psbt: invalid %s key %x", field, rec.Key)
+}
+
+// readMap reads the records of a map up to its 0x00 separator, refusing
+// duplicate keys.
+func readMap(r *bytes.Reader) ([]Record, error) {
+	var records []Record
+	seen := map[string]bool{}
+	for {
+		key, err := btctx.ReadVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return records, nil
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("psbt: duplicate key %x", key)
+		}
+		seen[string(key)] = true
+		value, err := btctx.ReadVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record{Key: key, Value: value})
+	}
+}
+
+// Serialize encodes the packet in binary, known fields first by key type,
+// then unknown records in the order they were read.
+func (p *Packet) Serialize() []byte {
+	w := &bytes.Buffer{}
+	w.Write(Magic)
+	writeRecord(w, []byte{globalUnsignedTx}, p.UnsignedTx)
+	writeRecords(w, p.Unknown)
+	w.WriteByte(0)
+
+	for _, in := range p.Inputs {
+		if in.NonWitnessUtxo != nil {
+			writeRecord(w, []byte{inputNonWitnessUtxo}, in.NonWitnessUtxo)
+		}
+		if in.WitnessUtxo != nil {
+			out := &bytes.Buffer{}
+			binary.Write(out, binary.LittleEndian, in.WitnessUtxo.Amount)
+			btctx.WriteVarBytes(out, in.WitnessUtxo.Script)
+			writeRecord(w, []byte{inputWitnessUtxo}, out.Bytes())
+		}
+		for _, sig := range in.PartialSigs {
+			writeRecord(w, append([]byte{inputPartialSig}, sig.PubKey...), sig.Signature)
+		}
+		if in.SighashType != nil {
+			sighash := make([]byte, 4)
+			binary.LittleEndian.PutUint32(sighash, *in.SighashType)
+			writeRecord(w, []byte{inputSighashType}, sighash)
+		}
+		if in.RedeemScript != nil {
+			writeRecord(w, []byte{inputRedeemScript}, in.RedeemScript)
+		}
+		if in.WitnessScript != nil {
+			writeRecord(w, []byte{inputWitnessScript}, in.WitnessScript)
+		}
+		writeDerivations(w, inputBIP32Derivation, in.Derivations)
+		if in.FinalScriptSig != nil {
+			writeRecord(w, []byte{inputFinalScriptSig}, in.FinalScriptSig)
+		}
+		if in.FinalScriptWitness != nil {
+			writeRecord(w, []byte{inputFinalScriptWitness}, in.FinalScriptWitness)
+		}
+		writeRecords(w, in.Unknown)
+		w.WriteByte(0)
+	}
+
+	for _, out := range p.Outputs {
+		if out.RedeemScript != nil {
+			writeRecord(w, []byte{outputRedeemScript}, out.RedeemScript)
+		}
+		if out.WitnessScript != nil {
+			writeRecord(w, []byte{outputWitnessScript}, out.WitnessScript)
+		}
+		writeDerivations(w, outputBIP32Derivation, out.Derivations)
+		writeRecords(w, out.Unknown)
+		w.WriteByte(0)
+	}
+	return w.Bytes()
+}
+
+// Base64 encodes the packet as base64.
+func (p *Packet) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
+
+func writeDerivations(w *bytes.Buffer, keyType byte, derivations []Derivation) {
+	for _, d := range derivations {
+		value := make([]byte, 4+4*len(d.Path))
+		binary.BigEndian.PutUint32(value, d.Fingerprint)
+		for i, index := range d.Path {
+			binary.LittleEndian.PutUint32(value[4+4*i:], index)
+		}
+		writeRecord(w, append([]byte{keyType}, d.PubKey...), value)
+	}
+}
+
+func writeRecords(w *bytes.Buffer, records []Record) {
+	for _, rec := range records {
+		writeRecord(w, rec.Key, rec.Value)
+	}
+}
+
+func writeRecord(w *bytes.Buffer, key, value []byte) {
+	btctx.WriteVarBytes(w, key)
+	btctx.WriteVarBytes(w, value)
+}
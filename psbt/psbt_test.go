@@ -0,0 +1,159 @@
+package psbt
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/conejoninja/cerrojo"
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for i, v := range validVectors {
+		b, _ := hex.DecodeString(v)
+		p, err := Parse(b)
+		if err != nil {
+			t.Errorf("vector %d: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(p.Serialize(), b) {
+			t.Errorf("vector %d: serialized differently\n%x", i, p.Serialize())
+		}
+		if back, err := ParseBase64(p.Base64()); err != nil || !bytes.Equal(back.Serialize(), b) {
+			t.Errorf("vector %d: base64 round trip failed %v", i, err)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for i, v := range invalidVectors {
+		b, _ := hex.DecodeString(v)
+		if _, err := Parse(b); err == nil {
+			t.Errorf("vector %d: expected an error", i)
+		}
+	}
+}
+
+// the master key fingerprint of the device in the tests
+const fingerprint = 0xd90c6a4f
+
+// signable returns the BIP-174 vector with a P2PKH and a P2SH-P2WPKH input
+// and two change outputs, with derivations from the device added to its
+// inputs.
+func signable(t *testing.T) *Packet {
+	b, _ := hex.DecodeString(validVectors[3])
+	p, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range p.Inputs {
+		p.Inputs[i].Derivations = []Derivation{{
+			PubKey:      append([]byte{2}, bytes.Repeat([]byte{byte(i + 1)}, 32)...),
+			Fingerprint: fingerprint,
+			Path:        cerrojo.StringToBIP32Path("m/49'/0'/0'/0/" + string(rune('0'+i))),
+		}}
+	}
+	return p
+}
+
+func TestTransaction(t *testing.T) {
+	d, _ := devices.GetDevice("trezor")
+	p := signable(t)
+	tx, err := p.Transaction(d.Types, "Bitcoin", fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Version != 2 || len(tx.Inputs) != 2 || len(tx.Outputs) != 2 {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+	if st := types.InputScriptTyper2Type(tx.Inputs[0].GetScriptType()); st != types.InputScriptType_SPENDADDRESS || tx.Inputs[0].GetAmount() == 0 {
+		t.Errorf("unexpected first input %v", tx.Inputs[0])
+	}
+	if st := types.InputScriptTyper2Type(tx.Inputs[1].GetScriptType()); st != types.InputScriptType_SPENDP2SHWITNESS || tx.Inputs[1].GetAmount() != 100000000 {
+		t.Errorf("unexpected second input %v", tx.Inputs[1])
+	}
+	if hex.EncodeToString(tx.Inputs[0].GetPrevHash()) != "e47b5b7a879f13a8213815cf3dc3f5b35af1e217f412829bc4f75a8ca04909ab" {
+		t.Errorf("expected the previous hash in display order, received %x", tx.Inputs[0].GetPrevHash())
+	}
+
+	// the outputs derive from another key, they are sent by address
+	for _, out := range tx.Outputs {
+		if out.GetAddress() == "" || out.GetAddressN() != nil {
+			t.Errorf("expected an output by address, received %v", out)
+		}
+	}
+	p.Outputs[0].Derivations[0].Fingerprint = fingerprint
+	if tx, err = p.Transaction(d.Types, "Bitcoin", fingerprint); err != nil || tx.Outputs[0].GetAddressN() == nil || tx.Outputs[0].GetAddress() != "" {
+		t.Errorf("expected a change output, received %v %v", tx.Outputs[0], err)
+	}
+
+	if _, err = p.Transaction(d.Types, "Bitcoin", 0x01020304); err == nil {
+		t.Error("expected inputs without derivation to be refused")
+	}
+	if _, err = p.Transaction(d.Types, "Dogecoin", fingerprint); err == nil {
+		t.Error("expected an unknown coin to be refused")
+	}
+}
+
+func txRequest(requestType trezortypes.RequestType, index uint32, txHash []byte, serialized *trezortypes.TxRequestSerializedType) *trezor.TxRequest {
+	return &trezor.TxRequest{
+		RequestType: requestType.Enum(),
+		Details:     &trezortypes.TxRequestDetailsType{RequestIndex: proto.Uint32(index), TxHash: txHash},
+		Serialized:  serialized,
+	}
+}
+
+func TestSign(t *testing.T) {
+	d, _ := devices.GetDevice("trezor")
+	mock := transport.NewMock(d.Messages)
+	var c cerrojo.Client
+	c.SetTransport(mock, d)
+
+	p := signable(t)
+	prevHash, _ := hex.DecodeString("e47b5b7a879f13a8213815cf3dc3f5b35af1e217f412829bc4f75a8ca04909ab")
+	signatures := [][]byte{{0x30, 0x44, 0x01}, {0x30, 0x44, 0x02}}
+	for _, msg := range []*trezor.TxRequest{
+		txRequest(trezortypes.RequestType_TXINPUT, 0, nil, nil),
+		txRequest(trezortypes.RequestType_TXMETA, 0, prevHash, nil),
+		txRequest(trezortypes.RequestType_TXINPUT, 1, nil, &trezortypes.TxRequestSerializedType{SignatureIndex: proto.Uint32(0), Signature: signatures[0]}),
+		txRequest(trezortypes.RequestType_TXFINISHED, 0, nil, &trezortypes.TxRequestSerializedType{SignatureIndex: proto.Uint32(1), Signature: signatures[1]}),
+	} {
+		if err := mock.Reply(common.MessageType_value["MessageType_MessageType_TxRequest"], msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.Sign(context.Background(), &c, "Bitcoin", fingerprint, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range p.Inputs {
+		if len(in.PartialSigs) != 1 || !bytes.Equal(in.PartialSigs[0].PubKey, in.Derivations[0].PubKey) ||
+			!bytes.Equal(in.PartialSigs[0].Signature, append(signatures[i], SighashAll)) {
+			t.Errorf("input %d: unexpected partial signatures %x", i, in.PartialSigs)
+		}
+	}
+
+	// the previous transaction was taken from the packet
+	written, err := mock.Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := written[2].(common.TxAcker).GetTx()
+	if meta.GetInputsCnt() != 1 || meta.GetOutputsCnt() != 2 {
+		t.Errorf("unexpected previous transaction meta %v", meta)
+	}
+
+	// signed packets survive a round trip
+	back, err := Parse(p.Serialize())
+	if err != nil || len(back.Inputs[1].PartialSigs) != 1 {
+		t.Errorf("unexpected packet after signing %v", err)
+	}
+}
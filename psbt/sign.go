@@ -0,0 +1,239 @@
+package psbt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/conejoninja/cerrojo"
+	"github.com/conejoninja/cerrojo/bitcoin/address"
+	btctx "github.com/conejoninja/cerrojo/bitcoin/tx"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// SighashAll is the only sighash type devices sign with.
+const SighashAll = 1
+
+// ErrPrevTxNotFound is returned by GetTx for transactions the packet does
+// not hold.
+var ErrPrevTxNotFound = errors.New("psbt: previous transaction not in packet")
+
+// Transaction maps the packet to the inputs and outputs of a SignTransaction
+// call, for the device with the master key fingerprint. Every input must
+// have a BIP-32 derivation from that key. Outputs with one are sent to the
+// device as change, by path, the others by address.
+func (p *Packet) Transaction(tp types.Typer, coin string, fingerprint uint32) (cerrojo.Transaction, error) {
+	params, ok := address.ByCoin(coin)
+	if !ok {
+		return cerrojo.Transaction{}, fmt.Errorf("psbt: unknown coin %q", coin)
+	}
+	unsigned, err := btctx.ParseLegacy(p.UnsignedTx)
+	if err != nil {
+		return cerrojo.Transaction{}, fmt.Errorf("psbt: unsigned transaction: %w", err)
+	}
+	if len(unsigned.Inputs) != len(p.Inputs) || len(unsigned.Outputs) != len(p.Outputs) {
+		return cerrojo.Transaction{}, errors.New("psbt: inputs and outputs do not match the unsigned transaction")
+	}
+
+	tx := cerrojo.Transaction{
+		Coin:     coin,
+		Version:  unsigned.Version,
+		LockTime: unsigned.LockTime,
+	}
+	for i, in := range p.Inputs {
+		input, err := in.txInput(tp, unsigned.Inputs[i], fingerprint)
+		if err != nil {
+			return cerrojo.Transaction{}, fmt.Errorf("psbt: input %d: %w", i, err)
+		}
+		tx.Inputs = append(tx.Inputs, input)
+	}
+	for i, out := range p.Outputs {
+		output, err := out.txOutput(tp, unsigned.Outputs[i], fingerprint, params)
+		if err != nil {
+			return cerrojo.Transaction{}, fmt.Errorf("psbt: output %d: %w", i, err)
+		}
+		tx.Outputs = append(tx.Outputs, output)
+	}
+	return tx, nil
+}
+
+// Sign has the device sign every input of the packet and adds the
+// signatures to their PartialSigs. The previous transactions the device asks
+// for are taken from the non-witness UTXOs of the packet, then from prevTxs
+// if it is not nil.
+func (p *Packet) Sign(ctx context.Context, c *cerrojo.Client, coin string, fingerprint uint32, prevTxs cerrojo.PrevTxProvider) error {
+	tx, err := p.Transaction(c.Types(), coin, fingerprint)
+	if err != nil {
+		return err
+	}
+	_, signatures, err := c.SignTransaction(ctx, tx, providers{p, prevTxs})
+	if err != nil {
+		return err
+	}
+	for i, sig := range signatures {
+		if sig == nil {
+			continue
+		}
+		in := &p.Inputs[i]
+		in.addPartialSig(PartialSig{
+			PubKey:    in.derivation(fingerprint).PubKey,
+			Signature: append(append([]byte{}, sig...), SighashAll),
+		})
+	}
+	return nil
+}
+
+// GetTx returns the non-witness UTXO of the packet with that txid, so the
+// packet is a cerrojo.PrevTxProvider.
+func (p *Packet) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	for _, in := range p.Inputs {
+		if in.NonWitnessUtxo == nil {
+			continue
+		}
+		if tx, err := btctx.Parse(in.NonWitnessUtxo); err == nil && tx.TxID() == txid {
+			return in.NonWitnessUtxo, nil
+		}
+	}
+	return nil, ErrPrevTxNotFound
+}
+
+// providers asks each non nil provider in turn.
+type providers []cerrojo.PrevTxProvider
+
+func (ps providers) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	err := ErrPrevTxNotFound
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		var raw []byte
+		if raw, err = p.GetTx(ctx, coin, txid); err == nil {
+			return raw, nil
+		}
+	}
+	return nil, err
+}
+
+func (in *Input) txInput(tp types.Typer, txIn btctx.Input, fingerprint uint32) (types.TxInputTyper, error) {
+	d := in.derivation(fingerprint)
+	if d == nil {
+		return nil, fmt.Errorf("no derivation for fingerprint %08x", fingerprint)
+	}
+	if in.SighashType != nil && *in.SighashType != SighashAll {
+		return nil, fmt.Errorf("sighash type %d not supported", *in.SighashType)
+	}
+	utxo, err := in.utxo(txIn)
+	if err != nil {
+		return nil, err
+	}
+
+	var scriptType cerrojo.ScriptType
+	switch {
+	case address.IsP2PKH(utxo.Script):
+		scriptType = cerrojo.P2PKH
+	case address.IsP2WPKH(utxo.Script):
+		scriptType = cerrojo.P2WPKH
+	case address.IsP2SH(utxo.Script) && address.IsP2WPKH(in.RedeemScript):
+		scriptType = cerrojo.P2SHP2WPKH
+	default:
+		return nil, fmt.Errorf("unsupported script %x", utxo.Script)
+	}
+
+	input := cerrojo.NewInput(tp, scriptType, d.Path, txIn.PrevHash, txIn.PrevIndex, utxo.Amount)
+	input.SetSequence(&txIn.Sequence)
+	return input, nil
+}
+
+// utxo returns the output spent by txIn, from the witness UTXO or from the
+// non-witness one after checking it is the transaction spent.
+func (in *Input) utxo(txIn btctx.Input) (*btctx.Output, error) {
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+	if in.NonWitnessUtxo == nil {
+		return nil, errors.New("no UTXO")
+	}
+	prev, err := btctx.Parse(in.NonWitnessUtxo)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(prev.Hash(), txIn.PrevHash) {
+		return nil, errors.New("non-witness UTXO does not match the spent transaction")
+	}
+	if int(txIn.PrevIndex) >= len(prev.Outputs) {
+		return nil, fmt.Errorf("non-witness UTXO has no output %d", txIn.PrevIndex)
+	}
+	return &prev.Outputs[txIn.PrevIndex], nil
+}
+
+func (in *Input) derivation(fingerprint uint32) *Derivation {
+	for i := range in.Derivations {
+		if in.Derivations[i].Fingerprint == fingerprint {
+			return &in.Derivations[i]
+		}
+	}
+	return nil
+}
+
+func (in *Input) addPartialSig(sig PartialSig) {
+	for i := range in.PartialSigs {
+		if bytes.Equal(in.PartialSigs[i].PubKey, sig.PubKey) {
+			in.PartialSigs[i] = sig
+			return
+		}
+	}
+	in.PartialSigs = append(in.PartialSigs, sig)
+}
+
+func (out *Output) txOutput(tp types.Typer, txOut btctx.Output, fingerprint uint32, params address.Params) (types.TxOutputTyper, error) {
+	if d := out.derivation(fingerprint); d != nil {
+		switch {
+		case address.IsP2PKH(txOut.Script):
+			return cerrojo.NewChangeOutput(tp, cerrojo.P2PKH, d.Path, txOut.Amount), nil
+		case address.IsP2WPKH(txOut.Script):
+			return cerrojo.NewChangeOutput(tp, cerrojo.P2WPKH, d.Path, txOut.Amount), nil
+		case address.IsP2SH(txOut.Script) && address.IsP2WPKH(out.RedeemScript):
+			return cerrojo.NewChangeOutput(tp, cerrojo.P2SHP2WPKH, d.Path, txOut.Amount), nil
+		}
+	}
+
+	if address.IsOpReturn(txOut.Script) {
+		data, err := opReturnData(txOut.Script)
+		if err != nil {
+			return nil, err
+		}
+		output := cerrojo.NewOpReturnOutput(tp, data)
+		output.SetAmount(&txOut.Amount)
+		return output, nil
+	}
+
+	addr, err := address.FromScript(txOut.Script, params)
+	if err != nil {
+		return nil, err
+	}
+	return cerrojo.NewOutput(tp, addr, txOut.Amount), nil
+}
+
+func (out *Output) derivation(fingerprint uint32) *Derivation {
+	for i := range out.Derivations {
+		if out.Derivations[i].Fingerprint == fingerprint {
+			return &out.Derivations[i]
+		}
+	}
+	return nil
+}
+
+// opReturnData returns the single push of an OP_RETURN script.
+func opReturnData(script []byte) ([]byte, error) {
+	push := script[1:]
+	switch {
+	case len(push) == 0:
+		return []byte{}, nil
+	case push[0] < 0x4c && int(push[0]) == len(push)-1:
+		return push[1:], nil
+	case push[0] == 0x4c && len(push) > 1 && int(push[1]) == len(push)-2:
+		return push[2:], nil
+	}
+	return nil, fmt.Errorf("unsupported OP_RETURN script %x", script)
+}
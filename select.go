@@ -0,0 +1,98 @@
+package cerrojo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+)
+
+var (
+	// ErrNoDevice is returned by Select when no device matches.
+	ErrNoDevice = errors.New("cerrojo: no matching device")
+	// ErrAmbiguousDevice is returned by Select when several devices match.
+	ErrAmbiguousDevice = errors.New("cerrojo: several devices match")
+)
+
+// Selector picks a device by its USB serial, or by the device_id or label
+// it reports in Features. Empty fields match any device.
+type Selector struct {
+	Serial   string
+	DeviceID string
+	Label    string
+}
+
+func (s Selector) String() string {
+	var fields []string
+	if s.Serial != "" {
+		fields = append(fields, "serial "+s.Serial)
+	}
+	if s.DeviceID != "" {
+		fields = append(fields, "device_id "+s.DeviceID)
+	}
+	if s.Label != "" {
+		fields = append(fields, "label "+s.Label)
+	}
+	if len(fields) == 0 {
+		return "any device"
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Select opens the only connected device matching s. Matching by DeviceID
+// or Label opens every candidate to ask for its Features, the ones not
+// selected are closed again.
+func Select(s Selector) (*Client, error) {
+	type match struct {
+		d Descriptor
+		c *Client
+	}
+	var matches []match
+	for _, d := range Enumerate() {
+		if s.Serial != "" && d.Serial != s.Serial {
+			continue
+		}
+		if s.DeviceID == "" && s.Label == "" {
+			matches = append(matches, match{d: d})
+			continue
+		}
+		c, err := d.Open()
+		if err != nil {
+			continue
+		}
+		if !s.matches(c) {
+			c.CloseTransport()
+			continue
+		}
+		matches = append(matches, match{d: d, c: c})
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoDevice, s)
+	}
+	if len(matches) == 1 {
+		if matches[0].c != nil {
+			return matches[0].c, nil
+		}
+		return matches[0].d.Open()
+	}
+	paths := make([]string, len(matches))
+	for i, m := range matches {
+		paths[i] = m.d.Path
+		if m.c != nil {
+			m.c.CloseTransport()
+		}
+	}
+	return nil, fmt.Errorf("%w: %s at %s", ErrAmbiguousDevice, s, strings.Join(paths, ", "))
+}
+
+func (s Selector) matches(c *Client) bool {
+	msg, msgType, err := c.CallMessage(c.GetFeatures())
+	if err != nil || msgType != common.MessageType_value["MessageType_MessageType_Features"] {
+		return false
+	}
+	features := msg.(common.Featureser)
+	return (s.DeviceID == "" || features.GetDeviceId() == s.DeviceID) &&
+		(s.Label == "" || features.GetLabel() == s.Label)
+}
@@ -0,0 +1,79 @@
+package cerrojo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+	"github.com/karalabe/usb"
+)
+
+// rack plugs three TREZORs, each answering GetFeatures with its device_id
+// and label, then a PONG.
+func rack(t *testing.T) map[string]*transport.Mock {
+	features := map[string][2]string{
+		"1-1:1.0": {"ID-SIGNER", "signer"},
+		"1-2:1.0": {"ID-BACKUP", "backup"},
+		"1-3:1.0": {"ID-SPARE", "backup"},
+	}
+	bus.plug(
+		usb.DeviceInfo{Path: "1-1:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "S1"},
+		usb.DeviceInfo{Path: "1-2:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "S2"},
+		usb.DeviceInfo{Path: "1-3:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "S2"},
+	)
+	mocks := map[string]*transport.Mock{}
+	bus.onOpen(func(info usb.DeviceInfo) (transport.Transport, error) {
+		d, _ := devices.GetDevice("trezor")
+		mock := transport.NewMock(d.Messages)
+		f := features[info.Path]
+		mock.Reply(common.MessageType_value["MessageType_MessageType_Features"], &trezor.Features{DeviceId: proto.String(f[0]), Label: proto.String(f[1])})
+		mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{Message: proto.String(info.Path)})
+		mocks[info.Path] = mock
+		return mock, nil
+	})
+	t.Cleanup(func() { bus.onOpen(nil) })
+	return mocks
+}
+
+func TestSelect(t *testing.T) {
+	for _, test := range []struct {
+		selector Selector
+		path     string
+		err      error
+	}{
+		{Selector{Serial: "S1"}, "1-1:1.0", nil},
+		{Selector{DeviceID: "ID-BACKUP"}, "1-2:1.0", nil},
+		{Selector{Label: "signer"}, "1-1:1.0", nil},
+		{Selector{Serial: "S2", DeviceID: "ID-SPARE"}, "1-3:1.0", nil},
+		{Selector{Serial: "S9"}, "", ErrNoDevice},
+		{Selector{DeviceID: "ID-NONE"}, "", ErrNoDevice},
+		{Selector{Serial: "S2"}, "", ErrAmbiguousDevice},
+		{Selector{Label: "backup"}, "", ErrAmbiguousDevice},
+	} {
+		mocks := rack(t)
+		c, err := Select(test.selector)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, received %v", test.selector, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if test.selector.DeviceID == "" && test.selector.Label == "" {
+			// no Features asked, skip the scripted answer
+			c.ReadMessage()
+		}
+		if str, _ := c.Call(c.Ping("", false, false, false)); str != test.path {
+			t.Errorf("%s: expected device %s, received %q", test.selector, test.path, str)
+		}
+		for path, mock := range mocks {
+			if _, _, _, err := mock.Read(); path != test.path && !errors.Is(err, transport.ErrDisconnected) {
+				t.Errorf("%s: expected %s to be closed", test.selector, path)
+			}
+		}
+	}
+}
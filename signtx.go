@@ -0,0 +1,141 @@
+package cerrojo
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	btctx "github.com/conejoninja/cerrojo/bitcoin/tx"
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// PrevTxProvider returns the raw previous transactions the device asks for
+// while signing, txid is the transaction hash in hex as shown by block
+// explorers.
+type PrevTxProvider interface {
+	GetTx(ctx context.Context, coin, txid string) ([]byte, error)
+}
+
+// Transaction is a transaction to sign with SignTransaction. Build its
+// inputs and outputs with the Types of the device profile.
+type Transaction struct {
+	Coin     string
+	Version  uint32
+	LockTime uint32
+	Inputs   []types.TxInputTyper
+	Outputs  []types.TxOutputTyper
+}
+
+// ErrNoPrevTxProvider is returned by SignTransaction when the device asks
+// for a previous transaction and no PrevTxProvider was given.
+var ErrNoPrevTxProvider = errors.New("cerrojo: previous transaction needed but no provider given")
+
+// ErrMissingAmount is returned by SignTransaction for segwit inputs without
+// the amount of the output they spend, which their signature commits to.
+var ErrMissingAmount = errors.New("cerrojo: segwit input without amount")
+
+// SignTransaction runs the whole SignTx exchange: it answers every TxRequest
+// with the inputs and outputs of tx or of the previous transactions fetched
+// from prevTxs, and returns the signed raw transaction and the signature of
+// each input. The device is held until signing is done.
+func (c *Client) SignTransaction(ctx context.Context, tx Transaction, prevTxs PrevTxProvider) ([]byte, [][]byte, error) {
+	for i, in := range tx.Inputs {
+		switch types.InputScriptTyper2Type(in.GetScriptType()) {
+		case types.InputScriptType_SPENDWITNESS, types.InputScriptType_SPENDP2SHWITNESS:
+			if in.GetAmount() == 0 {
+				return nil, nil, fmt.Errorf("%w %d", ErrMissingAmount, i)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var serialized []byte
+	signatures := make([][]byte, len(tx.Inputs))
+	cache := map[string]types.TransactionTyper{}
+
+	reply, msgType, err := c.call(ctx, c.SignTx(uint32(len(tx.Outputs)), uint32(len(tx.Inputs)), tx.Coin, tx.Version, tx.LockTime))
+	for {
+		if err != nil {
+			return nil, nil, err
+		}
+		if msgType != common.MessageType_value["MessageType_MessageType_TxRequest"] {
+			return nil, nil, fmt.Errorf("cerrojo: unexpected %s while signing", common.MessageType_name[msgType])
+		}
+		request := reply.(common.TxRequester)
+
+		// the getters are nil safe, missing fields read as zero values
+		s := request.GetSerialized()
+		serialized = append(serialized, s.GetSerializedTx()...)
+		if s.GetSignature() != nil && int(s.GetSignatureIndex()) < len(signatures) {
+			signatures[s.GetSignatureIndex()] = s.GetSignature()
+		}
+
+		requestType := types.RequestTyper2Type(request.GetRequestType())
+		if requestType == types.RequestType_TXFINISHED {
+			return serialized, signatures, nil
+		}
+
+		index := request.GetDetails().GetRequestIndex()
+		txHash := request.GetDetails().GetTxHash()
+
+		var prev types.TransactionTyper
+		if len(txHash) > 0 {
+			txid := hex.EncodeToString(txHash)
+			if prev = cache[txid]; prev == nil {
+				if prevTxs == nil {
+					return nil, nil, ErrNoPrevTxProvider
+				}
+				raw, err := prevTxs.GetTx(ctx, tx.Coin, txid)
+				if err != nil {
+					return nil, nil, err
+				}
+				parsed, err := btctx.Parse(raw)
+				if err != nil {
+					return nil, nil, fmt.Errorf("cerrojo: previous transaction %s: %w", txid, err)
+				}
+				if !bytes.Equal(parsed.Hash(), txHash) {
+					return nil, nil, fmt.Errorf("cerrojo: previous transaction %s: hash mismatch", txid)
+				}
+				prev = parsed.Transaction(c.tp)
+				cache[txid] = prev
+			}
+		}
+
+		ack, err := c.txAck(requestType, index, tx, prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		reply, msgType, err = c.call(ctx, c.TxAck(ack))
+	}
+}
+
+// txAck builds the answer to a TxRequest about tx, or about prev if the
+// device asks for a previous transaction.
+func (c *Client) txAck(requestType types.RequestType, index uint32, tx Transaction, prev types.TransactionTyper) (types.TransactionTyper, error) {
+	ack := c.tp.GetTransactionType()
+	switch {
+	case requestType == types.RequestType_TXMETA && prev != nil:
+		version, lockTime := prev.GetVersion(), prev.GetLockTime()
+		inputs, outputs := uint32(len(prev.GetInputs())), uint32(len(prev.GetBinOutputs()))
+		ack.SetVersion(&version)
+		ack.SetLockTime(&lockTime)
+		ack.SetInputsCnt(&inputs)
+		ack.SetOutputsCnt(&outputs)
+	case requestType == types.RequestType_TXINPUT && prev != nil && index < uint32(len(prev.GetInputs())):
+		types.SetMessages(ack, "inputs", prev.GetInputs()[index])
+	case requestType == types.RequestType_TXOUTPUT && prev != nil && index < uint32(len(prev.GetBinOutputs())):
+		types.SetMessages(ack, "bin_outputs", prev.GetBinOutputs()[index])
+	case requestType == types.RequestType_TXINPUT && prev == nil && index < uint32(len(tx.Inputs)):
+		types.SetMessages(ack, "inputs", tx.Inputs[index])
+	case requestType == types.RequestType_TXOUTPUT && prev == nil && index < uint32(len(tx.Outputs)):
+		types.SetMessages(ack, "outputs", tx.Outputs[index])
+	default:
+		return nil, fmt.Errorf("cerrojo: cannot answer TxRequest %d for index %d", requestType, index)
+	}
+	return ack, nil
+}
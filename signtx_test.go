@@ -0,0 +1,290 @@
+package cerrojo
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	btctx "github.com/conejoninja/cerrojo/bitcoin/tx"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	trezortypes "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+	"github.com/golang/protobuf/proto"
+)
+
+// prevTx is a legacy transaction with one input and two outputs, the second
+// one paying 50000 satoshis to the key signing in TestSignTransaction.
+var prevTx, _ = hex.DecodeString("0100000001" +
+	"6ad6c6d8f5f4bc7ab8b0b2c5e4e7d0f2a0b5b3c8d9e0f1a2b3c4d5e6f7a8b9c0" + "01000000" +
+	"6a" + "47304402200000000000000000000000000000000000000000000000000000000000000001022000000000000000000000000000000000000000000000000000000000000000010121" +
+	"02a1633cafcc01ebfb6d78e39f687a1f0995c62fc95f51ead10a02ee0be551b5dc" + "ffffffff" +
+	"02" +
+	"a086010000000000" + "1976a914" + "1111111111111111111111111111111111111111" + "88ac" +
+	"50c3000000000000" + "1976a914" + "2222222222222222222222222222222222222222" + "88ac" +
+	"00000000")
+
+func txid(raw []byte) string {
+	parsed, _ := btctx.Parse(raw)
+	return parsed.TxID()
+}
+
+type prevTxs map[string][]byte
+
+func (p prevTxs) GetTx(ctx context.Context, coin, txid string) ([]byte, error) {
+	if raw, ok := p[txid]; ok {
+		return raw, nil
+	}
+	return nil, errors.New("unknown transaction")
+}
+
+func txRequest(requestType trezortypes.RequestType, index uint32, txHash []byte, serialized *trezortypes.TxRequestSerializedType) *trezor.TxRequest {
+	return &trezor.TxRequest{
+		RequestType: requestType.Enum(),
+		Details:     &trezortypes.TxRequestDetailsType{RequestIndex: proto.Uint32(index), TxHash: txHash},
+		Serialized:  serialized,
+	}
+}
+
+func TestSignTransaction(t *testing.T) {
+	c, mock := mockClient()
+	c.SetUI(&ScriptedUI{})
+	prevHash, _ := hex.DecodeString(txid(prevTx))
+
+	input := &trezortypes.TxInputType{
+		AddressN:  StringToBIP32Path("m/44'/0'/0'/0/0"),
+		PrevHash:  prevHash,
+		PrevIndex: proto.Uint32(1),
+	}
+	output := &trezortypes.TxOutputType{
+		Address:    proto.String("1JAd7XCBzGudGpJQSDSfpmJhiygtLQWaGL"),
+		Amount:     proto.Uint64(40000),
+		ScriptType: trezortypes.OutputScriptType_PAYTOADDRESS.Enum(),
+	}
+
+	// the exchange of a TREZOR One signing one input and one output
+	chunk1, _ := hex.DecodeString("0100000001")
+	chunk2, _ := hex.DecodeString("0140")
+	signature := []byte{0x30, 0x44, 0x02, 0x20}
+	for _, r := range []struct {
+		name string
+		msg  proto.Message
+	}{
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, nil, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXMETA, 0, prevHash, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, prevHash, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 0, prevHash, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 1, prevHash, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 0, nil, nil)},
+		{"ButtonRequest", &trezor.ButtonRequest{Code: trezortypes.ButtonRequestType_ButtonRequest_ConfirmOutput.Enum()}},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, nil, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 0, nil, &trezortypes.TxRequestSerializedType{
+			SignatureIndex: proto.Uint32(0), Signature: signature, SerializedTx: chunk1,
+		})},
+		{"TxRequest", &trezor.TxRequest{RequestType: trezortypes.RequestType_TXFINISHED.Enum(), Serialized: &trezortypes.TxRequestSerializedType{SerializedTx: chunk2}}},
+	} {
+		reply(t, mock, r.name, r.msg)
+	}
+
+	raw, signatures, err := c.SignTransaction(context.Background(), Transaction{
+		Coin:    "Bitcoin",
+		Version: 1,
+		Inputs:  []types.TxInputTyper{input},
+		Outputs: []types.TxOutputTyper{output},
+	}, prevTxs{txid(prevTx): prevTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, append(chunk1, chunk2...)) {
+		t.Errorf("unexpected raw transaction %x", raw)
+	}
+	if len(signatures) != 1 || !bytes.Equal(signatures[0], signature) {
+		t.Errorf("unexpected signatures %x", signatures)
+	}
+
+	requests, err := mock.Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	acks := map[int]func(tx types.TransactionTyper) bool{
+		1: func(tx types.TransactionTyper) bool { // current input
+			return bytes.Equal(tx.GetInputs()[0].GetPrevHash(), prevHash)
+		},
+		2: func(tx types.TransactionTyper) bool { // previous meta
+			return tx.GetVersion() == 1 && tx.GetInputsCnt() == 1 && tx.GetOutputsCnt() == 2
+		},
+		3: func(tx types.TransactionTyper) bool { // previous input, in display order
+			return hex.EncodeToString(tx.GetInputs()[0].GetPrevHash()) == "c0b9a8f7e6d5c4b3a2f1e0d9c8b3b5a0f2d0e7e4c5b2b0b87abcf4f5d8c6d66a" && tx.GetInputs()[0].GetSequence() == 0xffffffff
+		},
+		4: func(tx types.TransactionTyper) bool { // previous bin outputs
+			return tx.GetBinOutputs()[0].GetAmount() == 100000
+		},
+		5: func(tx types.TransactionTyper) bool {
+			return tx.GetBinOutputs()[0].GetAmount() == 50000 && bytes.Contains(tx.GetBinOutputs()[0].GetScriptPubkey(), bytes.Repeat([]byte{0x22}, 20))
+		},
+		6: func(tx types.TransactionTyper) bool { // current output
+			return tx.GetOutputs()[0].GetAmount() == 40000
+		},
+	}
+	if len(requests) != 10 {
+		t.Fatalf("expected 10 messages written, received %d", len(requests))
+	}
+	for i, check := range acks {
+		ack, ok := requests[i].(common.TxAcker)
+		if !ok || !check(ack.GetTx()) {
+			t.Errorf("unexpected TxAck %d: %v", i, requests[i])
+		}
+	}
+	// optional fields left unset stay unset, the device refuses an empty
+	// multisig
+	for _, i := range []int{1, 3} {
+		if input := requests[i].(*trezor.TxAck).Tx.Inputs[0]; input.Multisig != nil || input.Amount != nil {
+			t.Errorf("unexpected optional fields in TxAck %d: %v", i, input)
+		}
+	}
+	if output := requests[6].(*trezor.TxAck).Tx.Outputs[0]; output.Multisig != nil || output.AddressN != nil {
+		t.Errorf("unexpected optional fields in TxAck 6: %v", output)
+	}
+	if _, ok := requests[7].(common.ButtonAcker); !ok {
+		t.Errorf("expected the button request to be acknowledged, received %v", requests[7])
+	}
+}
+
+func TestSignTransactionErrors(t *testing.T) {
+	c, mock := mockClient()
+	prevHash, _ := hex.DecodeString(txid(prevTx))
+	tx := Transaction{Coin: "Bitcoin", Inputs: []types.TxInputTyper{&trezortypes.TxInputType{PrevHash: prevHash}}}
+
+	reply(t, mock, "TxRequest", txRequest(trezortypes.RequestType_TXMETA, 0, prevHash, nil))
+	if _, _, err := c.SignTransaction(context.Background(), tx, nil); err != ErrNoPrevTxProvider {
+		t.Errorf("expected ErrNoPrevTxProvider, received %v", err)
+	}
+
+	// a provider returning another transaction than the one asked for
+	tampered := append([]byte{}, prevTx...)
+	tampered[len(tampered)-20] ^= 1
+	reply(t, mock, "TxRequest", txRequest(trezortypes.RequestType_TXMETA, 0, prevHash, nil))
+	if _, _, err := c.SignTransaction(context.Background(), tx, prevTxs{txid(prevTx): tampered}); err == nil {
+		t.Error("expected a tampered previous transaction to be refused")
+	}
+
+	reply(t, mock, "Failure", &trezor.Failure{Code: trezortypes.FailureType_Failure_NotEnoughFunds.Enum()})
+	if _, _, err := c.SignTransaction(context.Background(), tx, nil); !errors.Is(err, ErrNotEnoughFunds) {
+		t.Errorf("expected ErrNotEnoughFunds, received %v", err)
+	}
+}
+
+// bip143Signed is the P2SH-P2WPKH example of BIP-143, a nested segwit input
+// of 10 BTC paying 1.999966 BTC out and 8 BTC back, signed.
+var bip143Signed, _ = hex.DecodeString("01000000" + "0001" + "01" +
+	"db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a5477" + "01000000" +
+	"17" + "16001479091972186c449eb1ded22b78e40d009bdf0089" + "feffffff" +
+	"02" +
+	"b8b4eb0b00000000" + "1976a914" + "a457b684d7f0d539a46a45bbc043f35b59d0d963" + "88ac" +
+	"0008af2f00000000" + "1976a914" + "fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c" + "88ac" +
+	"02" + "47" + bip143Signature + "01" +
+	"21" + "03ad1d8e89212f0b92c74d23bb710c00662ad1470198ac48c43f7d6f93a2a26873" +
+	"92040000")
+
+const bip143Signature = "3044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb"
+
+// TestSignTransactionSegwit signs the BIP-143 P2SH-P2WPKH example, the
+// device answering with the published transaction and signature, and
+// checks the input and change output built from their paths reach it.
+func TestSignTransactionSegwit(t *testing.T) {
+	c, mock := mockClient()
+	c.SetUI(&ScriptedUI{})
+
+	// the published transaction, streamed in chunks as the device does
+	chunks := [][]byte{bip143Signed[:7], bip143Signed[7:62], bip143Signed[62:96], bip143Signed[96:130], bip143Signed[130:]}
+	signature, _ := hex.DecodeString(bip143Signature)
+	for _, r := range []struct {
+		name string
+		msg  proto.Message
+	}{
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, nil, nil)},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 0, nil, nil)},
+		{"ButtonRequest", &trezor.ButtonRequest{Code: trezortypes.ButtonRequestType_ButtonRequest_ConfirmOutput.Enum()}},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 1, nil, nil)},
+		{"ButtonRequest", &trezor.ButtonRequest{Code: trezortypes.ButtonRequestType_ButtonRequest_SignTx.Enum()}},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, nil, &trezortypes.TxRequestSerializedType{SerializedTx: chunks[0]})},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 0, nil, &trezortypes.TxRequestSerializedType{SerializedTx: chunks[1]})},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXOUTPUT, 1, nil, &trezortypes.TxRequestSerializedType{SerializedTx: chunks[2]})},
+		{"TxRequest", txRequest(trezortypes.RequestType_TXINPUT, 0, nil, &trezortypes.TxRequestSerializedType{SerializedTx: chunks[3]})},
+		{"TxRequest", &trezor.TxRequest{RequestType: trezortypes.RequestType_TXFINISHED.Enum(), Serialized: &trezortypes.TxRequestSerializedType{
+			SignatureIndex: proto.Uint32(0), Signature: signature, SerializedTx: chunks[4],
+		}}},
+	} {
+		reply(t, mock, r.name, r.msg)
+	}
+
+	tp := c.Types()
+	prevHash, _ := hex.DecodeString("77541aeb3c4dac9260b68f74f44c973081a9d4cb2ebe8038b2d70faa201b6bdb")
+	inputPath := StringToBIP32Path("m/49'/0'/0'/0/0")
+	changePath := StringToBIP32Path("m/44'/0'/0'/1/0")
+	input := NewInput(tp, ScriptTypeForPath(inputPath), inputPath, prevHash, 1, 1000000000)
+	input.SetSequence(proto.Uint32(0xfffffffe))
+	raw, signatures, err := c.SignTransaction(context.Background(), Transaction{
+		Coin:     "Bitcoin",
+		Version:  1,
+		LockTime: 1170,
+		Inputs:   []types.TxInputTyper{input},
+		Outputs: []types.TxOutputTyper{
+			NewOutput(tp, "1Fyxts6r24DpEieygQiNnWxUdb18ANa5p7", 199996600),
+			NewChangeOutput(tp, ScriptTypeForPath(changePath), changePath, 800000000),
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, bip143Signed) {
+		t.Errorf("unexpected raw transaction %x", raw)
+	}
+	if len(signatures) != 1 || !bytes.Equal(signatures[0], signature) {
+		t.Errorf("unexpected signatures %x", signatures)
+	}
+	parsed, err := btctx.Parse(raw)
+	if err != nil || len(parsed.Inputs) != 1 || len(parsed.Outputs) != 2 || parsed.LockTime != 1170 {
+		t.Errorf("unexpected signed transaction %+v %v", parsed, err)
+	}
+
+	requests, err := mock.Written()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 10 {
+		t.Fatalf("expected 10 messages written, received %d", len(requests))
+	}
+	signTx := requests[0].(*trezor.SignTx)
+	if signTx.GetLockTime() != 1170 || signTx.GetInputsCount() != 1 || signTx.GetOutputsCount() != 2 {
+		t.Errorf("unexpected SignTx %v", signTx)
+	}
+	in := requests[1].(*trezor.TxAck).Tx.Inputs[0]
+	if types.InputScriptTyper2Type(in.GetScriptType()) != types.InputScriptType_SPENDP2SHWITNESS || in.GetAmount() != 1000000000 || in.GetSequence() != 0xfffffffe ||
+		!bytes.Equal(in.GetPrevHash(), prevHash) || in.GetPrevIndex() != 1 || !reflect.DeepEqual(in.GetAddressN(), inputPath) {
+		t.Errorf("unexpected input %v", in)
+	}
+	change := requests[4].(*trezor.TxAck).Tx.Outputs[0]
+	if types.OutputScriptTyper2Type(change.GetScriptType()) != types.OutputScriptType_PAYTOADDRESS || change.Address != nil || change.GetAmount() != 800000000 ||
+		!reflect.DeepEqual(change.GetAddressN(), changePath) {
+		t.Errorf("unexpected change output %v", change)
+	}
+}
+
+func TestSignTransactionMissingAmount(t *testing.T) {
+	c, mock := mockClient()
+	prevHash, _ := hex.DecodeString(txid(prevTx))
+	tx := Transaction{Coin: "Bitcoin", Inputs: []types.TxInputTyper{
+		NewInput(c.Types(), P2PKH, StringToBIP32Path("m/44'/0'/0'/0/0"), prevHash, 1, 0),
+		NewInput(c.Types(), P2WPKH, StringToBIP32Path("m/84'/0'/0'/0/0"), prevHash, 0, 0),
+	}}
+	if _, _, err := c.SignTransaction(context.Background(), tx, nil); !errors.Is(err, ErrMissingAmount) {
+		t.Errorf("expected ErrMissingAmount, received %v", err)
+	}
+	if len(mock.Frames()) != 0 {
+		t.Error("expected nothing sent to the device")
+	}
+}
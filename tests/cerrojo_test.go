@@ -58,7 +58,7 @@ func TestPing(t *testing.T) {
 		t.Logf("\tChecking PING for response \"%s\"",
 			expectedPing)
 		{
-			str, msgType := commontest.Call(client, client.Ping(expectedPing, false, false, false))
+			str, msgType := commontest.Call(&client, client.Ping(expectedPing, false, false, false))
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -83,7 +83,7 @@ func TestPingButton(t *testing.T) {
 		t.Logf("\tChecking PING for response \"%s\"",
 			expectedPing)
 		{
-			str, msgType := commontest.Call(client, client.Ping(expectedPing, false, false, true))
+			str, msgType := commontest.Call(&client, client.Ping(expectedPing, false, false, true))
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -109,7 +109,7 @@ func TestPingButtonCancel(t *testing.T) {
 		t.Logf("\tChecking PING for response \"%s\"",
 			expectedPing)
 		{
-			str, msgType := commontest.Call(client, client.Ping(expectedPing, false, false, true))
+			str, msgType := commontest.Call(&client, client.Ping(expectedPing, false, false, true))
 
 			if msgType != 3 {
 				t.Errorf("\t\tExpected msgType=3, received %d", msgType)
@@ -130,7 +130,7 @@ func TestInitialize(t *testing.T) {
 	{
 		t.Log("\tChecking Initialize for response ")
 		{
-			_, msgType := commontest.Call(client, client.Initialize())
+			_, msgType := commontest.Call(&client, client.Initialize())
 
 			if msgType != 17 {
 				t.Errorf("\t\tExpected msgType=17, received %d", msgType)
@@ -147,7 +147,7 @@ func TestGetFeatures(t *testing.T) {
 	{
 		t.Log("\tChecking GetFeatures for response ")
 		{
-			_, msgType := commontest.Call(client, client.GetFeatures())
+			_, msgType := commontest.Call(&client, client.GetFeatures())
 
 			if msgType != 17 {
 				t.Errorf("\t\tExpected msgType=17, received %d", msgType)
@@ -164,7 +164,7 @@ func TestClearSession(t *testing.T) {
 	{
 		t.Log("\tChecking ClearSession for response ")
 		{
-			_, msgType := commontest.Call(client, client.ClearSession())
+			_, msgType := commontest.Call(&client, client.ClearSession())
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -182,7 +182,7 @@ func TestGetEntropy(t *testing.T) {
 	{
 		t.Log("\tChecking GetEntropy for response ")
 		{
-			str, msgType := commontest.Call(client, client.GetEntropy(8))
+			str, msgType := commontest.Call(&client, client.GetEntropy(8))
 
 			if msgType != 10 {
 				t.Errorf("\t\tExpected msgType=10, received %d", msgType)
@@ -206,7 +206,7 @@ func aTestLoadDevice12(t *testing.T) {
 		t.Log("\tWe need to wipe it first")
 		{
 			fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-			_, msgType := commontest.Call(client, client.WipeDevice())
+			_, msgType := commontest.Call(&client, client.WipeDevice())
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -215,11 +215,11 @@ func aTestLoadDevice12(t *testing.T) {
 				t.Log("\t\tChecking LoadDevice with 12 words")
 				{
 					fmt.Println("[WHAT TO DO] Click on \"I take the risk\"")
-					_, msgType = commontest.Call(client, client.LoadDevice(commontest.Mnemonic12, false, "", "", true, 0))
+					_, msgType = commontest.Call(&client, client.LoadDevice(commontest.Mnemonic12, false, "", "", true, 0))
 					if msgType != 2 {
 						t.Errorf("\t\tExpected msgType=2, received %d", msgType)
 					} else {
-						str, msgType := commontest.Call(client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
+						str, msgType := commontest.Call(&client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
 						if msgType != 30 {
 							t.Errorf("\t\tExpected msgType=30, received %d", msgType)
 						} else {
@@ -243,7 +243,7 @@ func aTestLoadDevice18(t *testing.T) {
 		t.Log("\tWe need to wipe it first")
 		{
 			fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-			_, msgType := commontest.Call(client, client.WipeDevice())
+			_, msgType := commontest.Call(&client, client.WipeDevice())
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -252,11 +252,11 @@ func aTestLoadDevice18(t *testing.T) {
 				t.Log("\t\tChecking LoadDevice with 18 words")
 				{
 					fmt.Println("[WHAT TO DO] Click on \"I take the risk\"")
-					_, msgType = commontest.Call(client, client.LoadDevice(commontest.Mnemonic18, false, "", "", true, 0))
+					_, msgType = commontest.Call(&client, client.LoadDevice(commontest.Mnemonic18, false, "", "", true, 0))
 					if msgType != 2 {
 						t.Errorf("\t\tExpected msgType=2, received %d", msgType)
 					} else {
-						str, msgType := commontest.Call(client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
+						str, msgType := commontest.Call(&client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
 						if msgType != 30 {
 							t.Errorf("\t\tExpected msgType=30, received %d", msgType)
 						} else {
@@ -280,7 +280,7 @@ func TestLoadDevice24(t *testing.T) {
 		t.Log("\tWe need to wipe it first")
 		{
 			fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-			_, msgType := commontest.Call(client, client.WipeDevice())
+			_, msgType := commontest.Call(&client, client.WipeDevice())
 
 			if msgType != 2 {
 				t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -289,11 +289,11 @@ func TestLoadDevice24(t *testing.T) {
 				t.Log("\tChecking LoadDevice with 24 words")
 				{
 					fmt.Println("[WHAT TO DO] Click on \"I take the risk\"")
-					_, msgType = commontest.Call(client, client.LoadDevice(commontest.Mnemonic24, false, "", "", true, 0))
+					_, msgType = commontest.Call(&client, client.LoadDevice(commontest.Mnemonic24, false, "", "", true, 0))
 					if msgType != 2 {
 						t.Errorf("\t\tExpected msgType=2, received %d", msgType)
 					} else {
-						str, msgType := commontest.Call(client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
+						str, msgType := commontest.Call(&client, client.GetAddress(tesoro.StringToBIP32Path(commontest.DefaultPath), false, commontest.DefaultCoin))
 						if msgType != 30 {
 							t.Errorf("\t\tExpected msgType=30, received %d", msgType)
 						} else {
@@ -316,7 +316,7 @@ func TestSetLabel(t *testing.T) {
 	t.Log("We need to test the SetLabel.")
 	{
 		fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-		str, msgType := commontest.Call(client, client.SetLabel(expectedLabel))
+		str, msgType := commontest.Call(&client, client.SetLabel(expectedLabel))
 
 		if msgType != 2 {
 			t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -324,7 +324,7 @@ func TestSetLabel(t *testing.T) {
 
 			t.Log("\tChecking SetLabel")
 			{
-				str, msgType = commontest.Call(client, client.GetFeatures())
+				str, msgType = commontest.Call(&client, client.GetFeatures())
 				if msgType != 17 {
 					t.Error("\t\tError initializing the device")
 				} else {
@@ -349,7 +349,7 @@ func TestSetLabel2(t *testing.T) {
 	t.Log("We need to test the SetLabel.")
 	{
 		fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-		str, msgType := commontest.Call(client, client.SetLabel(expectedLabel))
+		str, msgType := commontest.Call(&client, client.SetLabel(expectedLabel))
 
 		if msgType != 2 {
 			t.Errorf("\t\tExpected msgType=2, received %d", msgType)
@@ -357,7 +357,7 @@ func TestSetLabel2(t *testing.T) {
 
 			t.Log("\tChecking SetLabel")
 			{
-				str, msgType = commontest.Call(client, client.GetFeatures())
+				str, msgType = commontest.Call(&client, client.GetFeatures())
 				if msgType != 17 {
 					t.Error("\t\tError initializing the device")
 				} else {
@@ -385,7 +385,7 @@ func TestSetHomeScreen(t *testing.T) {
 			t.Errorf("\t\tError reading homescreen: %s", err)
 		}
 		fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-		_, msgType := commontest.Call(client, client.SetHomescreen(hs))
+		_, msgType := commontest.Call(&client, client.SetHomescreen(hs))
 		if msgType != 2 {
 			t.Errorf("\t\tExpected msgType=2, received %d", msgType)
 		} else {
@@ -403,7 +403,7 @@ func TestSetHomeScreen2(t *testing.T) {
 			t.Errorf("\t\tError reading homescreen: %s", err)
 		}
 		fmt.Println("[WHAT TO DO] Click on \"Confirm\"")
-		_, msgType := commontest.Call(client, client.SetHomescreen(hs))
+		_, msgType := commontest.Call(&client, client.SetHomescreen(hs))
 		if msgType != 2 {
 			t.Errorf("\t\tExpected msgType=2, received %d", msgType)
 		} else {
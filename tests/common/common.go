@@ -18,7 +18,7 @@ const Pin8 = "45678978"
 const DefaultPath = "m/44'/0'/0'"
 const DefaultCoin = "Bitcoin"
 
-func Call(client cerrojo.Client, msg []byte) (string, uint16) {
+func Call(client *cerrojo.Client, msg []byte) (string, uint16) {
 	str, msgType := client.Call(msg)
 
 	if msgType == 18 {
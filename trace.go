@@ -0,0 +1,108 @@
+package cerrojo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+// Redacted replaces the value of secret fields in traced messages.
+const Redacted = transport.Redacted
+
+// Tracer receives every message exchanged with the device, set it with
+// Client.SetTracer to debug a stuck exchange.
+type Tracer interface {
+	Trace(TracedMessage)
+}
+
+// TracedMessage is a message sent (transport.Sent) or received
+// (transport.Received) by a Client, decoded into its fields with the
+// secrets redacted.
+type TracedMessage struct {
+	Direction string
+	Type      common.MessageType
+	Name      string
+	Fields    map[string]interface{}
+}
+
+// LogValue logs the message as a group of its direction, name and fields.
+func (m TracedMessage) LogValue() slog.Value {
+	names := make([]string, 0, len(m.Fields))
+	for name := range m.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]slog.Attr, len(names))
+	for i, name := range names {
+		fields[i] = slog.Any(name, m.Fields[name])
+	}
+	return slog.GroupValue(
+		slog.String("direction", m.Direction),
+		slog.String("type", m.Name),
+		slog.Attr{Key: "fields", Value: slog.GroupValue(fields...)},
+	)
+}
+
+type slogTracer struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogTracer returns a Tracer logging every message to logger at the
+// given level.
+func NewSlogTracer(logger *slog.Logger, level slog.Level) Tracer {
+	return slogTracer{logger: logger, level: level}
+}
+
+func (t slogTracer) Trace(m TracedMessage) {
+	t.logger.LogAttrs(context.Background(), t.level, "cerrojo "+m.Direction+" "+m.Name, slog.Any("message", m))
+}
+
+// SetTracer sets the Tracer receiving every message, nil stops tracing.
+func (c *Client) SetTracer(tracer Tracer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tracer = tracer
+}
+
+// write sends a framed message to the device, tracing it. Transports
+// blocking in Write until the answer give up when ctx is done.
+func (c *Client) write(ctx context.Context, msg []byte) error {
+	if c.tracer != nil && len(msg) >= 8 {
+		msgType := common.MessageType(binary.BigEndian.Uint16(msg[2:4]))
+		msgLength := int(binary.BigEndian.Uint32(msg[4:8]))
+		if msgLength <= len(msg)-8 {
+			c.trace(transport.Sent, msgType, msg[8:8+msgLength])
+		}
+	}
+	if w, ok := c.t.(transport.ContextWriter); ok {
+		return w.WriteContext(ctx, msg)
+	}
+	return c.t.Write(msg)
+}
+
+func (c *Client) trace(direction string, msgType common.MessageType, payload []byte) {
+	if c.tracer == nil {
+		return
+	}
+	name := strings.TrimPrefix(common.MessageType_name[msgType], "MessageType_MessageType_")
+	traced := TracedMessage{Direction: direction, Type: msgType, Name: name, Fields: map[string]interface{}{}}
+	if msg := common.NewMessage(c.m, msgType); msg != nil && proto.Unmarshal(payload, msg) == nil {
+		if data, err := json.Marshal(msg); err == nil {
+			json.Unmarshal(data, &traced.Fields)
+		}
+	}
+	for _, field := range transport.SecretFields[name] {
+		if _, ok := traced.Fields[field]; ok {
+			traced.Fields[field] = Redacted
+		}
+	}
+	c.tracer.Trace(traced)
+}
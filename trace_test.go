@@ -0,0 +1,89 @@
+package cerrojo
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	keepkey "github.com/conejoninja/cerrojo/pb/keepkey/messages"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+)
+
+type traces []TracedMessage
+
+func (t *traces) Trace(m TracedMessage) {
+	*t = append(*t, m)
+}
+
+func TestTracer(t *testing.T) {
+	c, mock := mockClient()
+	var traced traces
+	c.SetTracer(&traced)
+	c.SetUI(&ScriptedUI{Pins: []string{"1234"}})
+	reply(t, mock, "PinMatrixRequest", &trezor.PinMatrixRequest{})
+	reply(t, mock, "CipheredKeyValue", &trezor.CipheredKeyValue{Value: []byte("secret answer")})
+
+	c.CallMessage(c.CipherKeyValue(true, "key", []byte("secret value"), StringToBIP32Path("m/10016'/0"), []byte{}, true, true))
+
+	expected := []struct {
+		direction, name string
+		fields          map[string]interface{}
+	}{
+		{transport.Sent, "CipherKeyValue", map[string]interface{}{"key": "key", "value": Redacted}},
+		{transport.Received, "PinMatrixRequest", nil},
+		{transport.Sent, "PinMatrixAck", map[string]interface{}{"pin": Redacted}},
+		{transport.Received, "CipheredKeyValue", map[string]interface{}{"value": Redacted}},
+	}
+	if len(traced) != len(expected) {
+		t.Fatalf("expected %d messages traced, received %+v", len(expected), traced)
+	}
+	for i, e := range expected {
+		m := traced[i]
+		if m.Direction != e.direction || m.Name != e.name {
+			t.Errorf("%d: expected %s %s, received %s %s", i, e.direction, e.name, m.Direction, m.Name)
+		}
+		for field, value := range e.fields {
+			if m.Fields[field] != value {
+				t.Errorf("%d: expected %s.%s %v, received %v", i, e.name, field, value, m.Fields[field])
+			}
+		}
+	}
+}
+
+func TestSlogTracer(t *testing.T) {
+	c, mock := mockClient()
+	var buf bytes.Buffer
+	c.SetTracer(NewSlogTracer(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), slog.LevelDebug))
+	reply(t, mock, "Success", &trezor.Success{Message: proto.String("PONG")})
+
+	c.Call(c.PassphraseAck("correct horse"))
+
+	out := buf.String()
+	for _, s := range []string{`"type":"PassphraseAck"`, `"passphrase":"[redacted]"`, `"direction":"in"`, `"message":"PONG"`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %s in the log, received %s", s, out)
+		}
+	}
+	if strings.Contains(out, "correct horse") {
+		t.Errorf("passphrase leaked to the log %s", out)
+	}
+}
+
+func TestTraceCharacterAck(t *testing.T) {
+	d, _ := devices.GetDevice("keepkey")
+	var c Client
+	c.SetTransport(transport.NewMock(d.Messages), d)
+	var traced traces
+	c.SetTracer(&traced)
+
+	payload, _ := proto.Marshal(&keepkey.CharacterAck{Character: proto.String("x")})
+	c.trace(transport.Sent, common.MessageType_value["MessageType_MessageType_CharacterAck"], payload)
+	if len(traced) != 1 || traced[0].Name != "CharacterAck" || traced[0].Fields["character"] != Redacted {
+		t.Errorf("expected the character to be redacted, received %+v", traced)
+	}
+}
@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBridgeURL is where trezord listens by default.
+	DefaultBridgeURL = "http://127.0.0.1:21325"
+	// DefaultBridgeOrigin is sent as Origin header, trezord only answers to
+	// the origins it trusts.
+	DefaultBridgeOrigin = "http://localhost:8000"
+)
+
+// Bridge talks to a device through a running trezord bridge over its HTTP
+// API, sharing the device with the browser and desktop wallets. Call
+// Acquire before using it as a Transport.
+type Bridge struct {
+	URL    string
+	Origin string
+	Client *http.Client
+
+	session string
+	reply   *bridgeReply
+}
+
+// BridgeDevice is a device as listed by the bridge /enumerate endpoint.
+type BridgeDevice struct {
+	Path    string  `json:"path"`
+	Vendor  uint16  `json:"vendor"`
+	Product uint16  `json:"product"`
+	Session *string `json:"session"`
+	Debug   bool    `json:"debug,omitempty"`
+}
+
+type bridgeReply struct {
+	marshalled []byte
+	msgType    uint16
+	err        error
+}
+
+// bridgeErrors are the error codes trezord answers in the error field, all
+// with status 400, by the transport error they stand for.
+var bridgeErrors = map[string]uint16{
+	"wrong previous session":            DisconnectedError,
+	"session not found":                 DisconnectedError,
+	"device not found":                  DisconnectedError,
+	"device disconnected during action": DisconnectedError,
+	"malformed data":                    ProtocolError,
+	"other call in progress":            EndpointError,
+}
+
+// BridgeError is an error answered by the bridge.
+type BridgeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *BridgeError) Error() string {
+	return "bridge: " + e.Message
+}
+
+// Version returns the version of the running bridge.
+func (t *Bridge) Version() (string, error) {
+	var info struct {
+		Version string `json:"version"`
+	}
+	err := t.post(context.Background(), "/", nil, &info)
+	return info.Version, err
+}
+
+// Enumerate lists the devices the bridge sees.
+func (t *Bridge) Enumerate() ([]BridgeDevice, error) {
+	var devs []BridgeDevice
+	err := t.post(context.Background(), "/enumerate", nil, &devs)
+	return devs, err
+}
+
+// Acquire opens a session on the device at path, stealing it from the
+// session currently holding it, if any.
+func (t *Bridge) Acquire(path string) error {
+	previous := "null"
+	devs, err := t.Enumerate()
+	if err != nil {
+		return err
+	}
+	for _, d := range devs {
+		if d.Path == path && d.Session != nil {
+			previous = *d.Session
+		}
+	}
+
+	var session struct {
+		Session string `json:"session"`
+	}
+	if err = t.post(context.Background(), "/acquire/"+path+"/"+previous, nil, &session); err != nil {
+		return err
+	}
+	t.session = session.Session
+	return nil
+}
+
+// Session returns the session acquired on the bridge.
+func (t *Bridge) Session() string {
+	return t.session
+}
+
+// Close releases the session.
+func (t *Bridge) Close() {
+	if t.session != "" {
+		t.post(context.Background(), "/release/"+t.session, nil, nil)
+		t.session = ""
+	}
+}
+
+// Write sends msg through /call, which blocks until the device answers. The
+// answer is returned by the next Read.
+func (t *Bridge) Write(msg []byte) error {
+	return t.WriteContext(context.Background(), msg)
+}
+
+// WriteContext is Write giving up when ctx is done. The call is aborted and
+// the session released, which has the bridge drop the pending action, so
+// Acquire is needed before the next call.
+func (t *Bridge) WriteContext(ctx context.Context, msg []byte) error {
+	t.reply = nil
+	// 35 : '#' magic header
+	if len(msg) >= 2 && msg[0] == 35 && msg[1] == 35 {
+		msg = msg[2:]
+	}
+
+	var body []byte
+	err := t.post(ctx, "/call/"+t.session, []byte(hex.EncodeToString(msg)), &body)
+	if err != nil && ctx.Err() != nil {
+		t.Close()
+		return ctx.Err()
+	}
+	if err != nil {
+		return bridgeError(err)
+	}
+	if len(body) < 6 {
+		t.reply = &bridgeReply{msgType: ProtocolError, err: ErrProtocol}
+		return nil
+	}
+	msgType := binary.BigEndian.Uint16(body[0:2])
+	msgLength := int(binary.BigEndian.Uint32(body[2:6]))
+	if msgLength > len(body)-6 {
+		t.reply = &bridgeReply{msgType: ProtocolError, err: ErrProtocol}
+		return nil
+	}
+	t.reply = &bridgeReply{marshalled: body[6 : 6+msgLength], msgType: msgType}
+	return nil
+}
+
+// Read returns the answer to the last Write, or times out if there is none.
+func (t *Bridge) Read() ([]byte, uint16, int, error) {
+	reply := t.reply
+	if reply == nil {
+		time.Sleep(100 * time.Millisecond)
+		return nil, TimeoutError, 0, ErrTimeout
+	}
+	t.reply = nil
+	return reply.marshalled, reply.msgType, len(reply.marshalled), reply.err
+}
+
+// post calls a bridge endpoint. The /call answer is hex encoded, it is
+// decoded into a *[]byte result, any other result is decoded as JSON.
+func (t *Bridge) post(ctx context.Context, path string, body []byte, result interface{}) error {
+	url := t.URL
+	if url == "" {
+		url = DefaultBridgeURL
+	}
+	origin := t.Origin
+	if origin == "" {
+		origin = DefaultBridgeOrigin
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(url, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Origin", origin)
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &answer) != nil || answer.Error == "" {
+			answer.Error = resp.Status
+		}
+		return &BridgeError{StatusCode: resp.StatusCode, Message: answer.Error}
+	}
+
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*r, err = hex.DecodeString(strings.TrimSpace(string(data)))
+		return err
+	default:
+		return json.Unmarshal(data, result)
+	}
+}
+
+// bridgeError maps a failed call to a transport error from the error code
+// trezord answered, or the HTTP status for other answers. A bridge that
+// cannot be reached is a disconnection.
+func bridgeError(err error) *Error {
+	var bridgeErr *BridgeError
+	if !errors.As(err, &bridgeErr) {
+		return &Error{Kind: DisconnectedError, Err: err}
+	}
+	if kind, ok := bridgeErrors[bridgeErr.Message]; ok && bridgeErr.StatusCode == http.StatusBadRequest {
+		return &Error{Kind: kind, Err: err}
+	}
+	return &Error{Kind: EndpointError, Err: err}
+}
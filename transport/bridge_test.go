@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// trezord stands in for the bridge, it answers every call on session "1"
+// with a Success (type 2) message carrying "PONG".
+func trezord(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":"2.0.27"}`)
+	})
+	mux.HandleFunc("/enumerate", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"path":"1","vendor":21324,"product":1,"session":null}]`)
+	})
+	mux.HandleFunc("/acquire/1/null", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"session":"1"}`)
+	})
+	mux.HandleFunc("/release/1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{}`)
+	})
+	mux.HandleFunc("/call/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/call/1" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"wrong previous session"}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		msg, err := hex.DecodeString(string(body))
+		if err != nil || len(msg) < 6 || msg[1] != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"unexpected message"}`)
+			return
+		}
+		io.WriteString(w, hex.EncodeToString([]byte{0, 2, 0, 0, 0, 4, 'P', 'O', 'N', 'G'}))
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Origin") != DefaultBridgeOrigin {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBridge(t *testing.T) {
+	server := trezord(t)
+	bridge := Bridge{URL: server.URL}
+
+	version, err := bridge.Version()
+	if err != nil || version != "2.0.27" {
+		t.Fatalf("unexpected version %q %v", version, err)
+	}
+	devs, err := bridge.Enumerate()
+	if err != nil || len(devs) != 1 || devs[0].Path != "1" || devs[0].Vendor != 21324 {
+		t.Fatalf("unexpected devices %+v %v", devs, err)
+	}
+	if err = bridge.Acquire("1"); err != nil || bridge.Session() != "1" {
+		t.Fatalf("unexpected session %q %v", bridge.Session(), err)
+	}
+
+	if err = bridge.Write([]byte{35, 35, 0, 1, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	marshalled, msgType, msgLength, err := bridge.Read()
+	if err != nil || msgType != 2 || msgLength != 4 || !bytes.Equal(marshalled, []byte("PONG")) {
+		t.Errorf("unexpected reply %q %d %d %v", marshalled, msgType, msgLength, err)
+	}
+	if _, msgType, _, _ = bridge.Read(); msgType != TimeoutError {
+		t.Errorf("expected a timeout without pending call, received %d", msgType)
+	}
+
+	if err = bridge.Write([]byte{35, 35, 0, 55, 0, 0, 0, 0}); !errors.Is(err, ErrEndpoint) {
+		t.Errorf("expected an endpoint error, received %v", err)
+	}
+
+	bridge.Close()
+	if bridge.Session() != "" {
+		t.Errorf("expected the session to be released")
+	}
+}
+
+func TestBridgeWriteContext(t *testing.T) {
+	released := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/call/waiting":
+			// the device waits for a button until the call is aborted
+			io.ReadAll(r.Body)
+			<-r.Context().Done()
+		case "/call/stolen":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"wrong previous session"}`)
+		case "/call/malformed":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"malformed data"}`)
+		default:
+			released <- r.URL.Path
+		}
+	}))
+	defer server.Close()
+
+	bridge := Bridge{URL: server.URL, session: "waiting"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bridge.WriteContext(ctx, []byte{35, 35, 0, 1, 0, 0, 0, 0}); err != context.DeadlineExceeded {
+		t.Errorf("expected the call to be given up, received %v", err)
+	}
+	if path := <-released; path != "/release/waiting" || bridge.Session() != "" {
+		t.Errorf("expected the session to be released, received %s", path)
+	}
+
+	for session, kind := range map[string]*Error{"stolen": ErrDisconnected, "malformed": ErrProtocol} {
+		bridge = Bridge{URL: server.URL, session: session}
+		if err := bridge.Write([]byte{35, 35, 0, 1, 0, 0, 0, 0}); !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, received %v", session, kind, err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// Sent is the direction of frames written to the device.
+	Sent = "out"
+	// Received is the direction of frames read from the device.
+	Received = "in"
+)
+
+// Redacted replaces the value of secret fields in recorded messages.
+const Redacted = "[redacted]"
+
+// SecretFields are the fields holding PINs, passphrases, seeds and other
+// secrets, by message name. They are never traced nor recorded.
+var SecretFields = map[string][]string{
+	"PinMatrixAck":     {"pin"},
+	"PassphraseAck":    {"passphrase"},
+	"WordAck":          {"word"},
+	"CharacterAck":     {"character"},
+	"LoadDevice":       {"mnemonic", "node", "pin"},
+	"CipherKeyValue":   {"value"},
+	"CipheredKeyValue": {"value"},
+	"Entropy":          {"entropy"},
+	"EntropyAck":       {"entropy"},
+	"DebugLinkState":   {"pin", "mnemonic", "node", "reset_word", "reset_entropy", "recovery_fake_word"},
+}
+
+// ErrCassetteEnd is returned by Replayer.Read when every frame of the
+// cassette has been played.
+var ErrCassetteEnd = errors.New("replay: end of cassette")
+
+// Cassette is a session recorded by a Recorder, saved as JSON. The
+// SecretFields of its messages are cleared from the payloads and shown as
+// Redacted in the decoded messages.
+type Cassette struct {
+	Frames []CassetteFrame `json:"frames"`
+}
+
+// CassetteFrame is one message of a Cassette. Message is the payload decoded
+// for people reading the cassette, Payload is what gets replayed.
+type CassetteFrame struct {
+	Time      time.Time          `json:"time"`
+	Direction string             `json:"direction"`
+	Type      string             `json:"type"`
+	TypeID    common.MessageType `json:"type_id"`
+	Payload   string             `json:"payload"`
+	Message   json.RawMessage    `json:"message,omitempty"`
+}
+
+// LoadCassette reads a cassette saved by Recorder.Save.
+func LoadCassette(path string) (Cassette, error) {
+	var c Cassette
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// Save writes the cassette to path as indented JSON.
+func (c Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder wraps a Transport and records every message exchanged through it.
+type Recorder struct {
+	t        Transport
+	messages common.Messager
+
+	mu     sync.Mutex
+	frames []CassetteFrame
+}
+
+// NewRecorder records the messages exchanged through t, decoding them with
+// the given device messages, e.g. &trezor.Getter{}.
+func NewRecorder(t Transport, messages common.Messager) *Recorder {
+	return &Recorder{t: t, messages: messages}
+}
+
+func (r *Recorder) Write(msg []byte) error {
+	// 35 : '#' magic header
+	if len(msg) >= 8 && msg[0] == 35 && msg[1] == 35 {
+		msgType := binary.BigEndian.Uint16(msg[2:4])
+		msgLength := int(binary.BigEndian.Uint32(msg[4:8]))
+		if msgLength <= len(msg)-8 {
+			r.record(Sent, common.MessageType(msgType), msg[8:8+msgLength])
+		}
+	}
+	return r.t.Write(msg)
+}
+
+func (r *Recorder) Read() ([]byte, uint16, int, error) {
+	marshalled, msgType, msgLength, err := r.t.Read()
+	if err == nil {
+		r.record(Received, common.MessageType(msgType), marshalled)
+	}
+	return marshalled, msgType, msgLength, err
+}
+
+func (r *Recorder) Close() {
+	r.t.Close()
+}
+
+func (r *Recorder) record(direction string, msgType common.MessageType, payload []byte) {
+	frame := CassetteFrame{
+		Time:      time.Now().UTC(),
+		Direction: direction,
+		Type:      messageName(msgType),
+		TypeID:    msgType,
+	}
+	secrets := SecretFields[frame.Type]
+	if msg := common.NewMessage(r.messages, msgType); msg != nil && proto.Unmarshal(payload, msg) == nil {
+		frame.Message, _ = json.Marshal(msg)
+		if len(secrets) > 0 {
+			frame.Message = redactJSON(frame.Message, secrets)
+			payload, _ = proto.Marshal(redact(msg, secrets))
+		}
+	} else if len(secrets) > 0 {
+		payload = nil
+	}
+	frame.Payload = hex.EncodeToString(payload)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, frame)
+}
+
+// redact clears the given fields of msg.
+func redact(msg proto.Message, fields []string) proto.Message {
+	m := proto.MessageReflect(msg)
+	for _, field := range fields {
+		if fd := m.Descriptor().Fields().ByName(protoreflect.Name(field)); fd != nil {
+			m.Clear(fd)
+		}
+	}
+	return msg
+}
+
+// redactJSON replaces the given fields of a JSON message with Redacted.
+func redactJSON(data json.RawMessage, fields []string) json.RawMessage {
+	var decoded map[string]interface{}
+	if json.Unmarshal(data, &decoded) != nil {
+		return nil
+	}
+	for _, field := range fields {
+		if _, ok := decoded[field]; ok {
+			decoded[field] = Redacted
+		}
+	}
+	data, _ = json.Marshal(decoded)
+	return data
+}
+
+func messageName(msgType common.MessageType) string {
+	return strings.TrimPrefix(common.MessageType_name[msgType], "MessageType_MessageType_")
+}
+
+// Cassette returns the session recorded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Frames: append([]CassetteFrame{}, r.frames...)}
+}
+
+// Save writes the session recorded so far to path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Replayer is a Transport playing a Cassette back. Written messages must
+// match the recorded ones, only the type of the messages with SecretFields
+// is checked as their secrets were not recorded, and reads return the
+// recorded answers, secrets cleared.
+type Replayer struct {
+	mu     sync.Mutex
+	frames []CassetteFrame
+	closed bool
+}
+
+func NewReplayer(c Cassette) *Replayer {
+	return &Replayer{frames: append([]CassetteFrame{}, c.Frames...)}
+}
+
+// Pending returns how many frames have not been played yet.
+func (r *Replayer) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.frames)
+}
+
+func (r *Replayer) Write(msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return &Error{Kind: DisconnectedError, Err: errors.New("no such device")}
+	}
+	// 35 : '#' magic header
+	if len(msg) < 8 || msg[0] != 35 || msg[1] != 35 {
+		return &Error{Kind: ProtocolError, Err: errors.New("replay: no magic header")}
+	}
+	msgType := common.MessageType(binary.BigEndian.Uint16(msg[2:4]))
+	msgLength := int(binary.BigEndian.Uint32(msg[4:8]))
+	if msgLength > len(msg)-8 {
+		return &Error{Kind: ProtocolError, Err: errors.New("replay: truncated message")}
+	}
+
+	if len(r.frames) == 0 || r.frames[0].Direction != Sent {
+		return &Error{Kind: ProtocolError, Err: fmt.Errorf("replay: unexpected %s written", common.MessageType_name[msgType])}
+	}
+	frame := r.frames[0]
+	payload, err := hex.DecodeString(frame.Payload)
+	if err != nil {
+		return &Error{Kind: ProtocolError, Err: err}
+	}
+	if frame.TypeID != msgType || (SecretFields[frame.Type] == nil && !bytes.Equal(payload, msg[8:8+msgLength])) {
+		return &Error{Kind: ProtocolError, Err: fmt.Errorf("replay: expected %s %s, written %s %x", frame.Type, frame.Payload, common.MessageType_name[msgType], msg[8:8+msgLength])}
+	}
+	r.frames = r.frames[1:]
+	return nil
+}
+
+func (r *Replayer) Read() ([]byte, uint16, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, DisconnectedError, 0, &Error{Kind: DisconnectedError, Err: errors.New("no such device")}
+	}
+	if len(r.frames) == 0 {
+		return nil, DisconnectedError, 0, &Error{Kind: DisconnectedError, Err: ErrCassetteEnd}
+	}
+	if r.frames[0].Direction != Received {
+		return nil, ProtocolError, 0, &Error{Kind: ProtocolError, Err: fmt.Errorf("replay: read while %s is expected to be written", r.frames[0].Type)}
+	}
+	frame := r.frames[0]
+	r.frames = r.frames[1:]
+	payload, err := hex.DecodeString(frame.Payload)
+	if err != nil {
+		return nil, ProtocolError, 0, &Error{Kind: ProtocolError, Err: err}
+	}
+	return payload, uint16(frame.TypeID), len(payload), nil
+}
+
+func (r *Replayer) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
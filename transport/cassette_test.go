@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport/wire"
+	"github.com/golang/protobuf/proto"
+)
+
+func frame(t *testing.T, name string, msg proto.Message) []byte {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgType := common.MessageType_value["MessageType_MessageType_"+name]
+	return append(wire.Header(uint16(msgType), len(payload)), payload...)
+}
+
+func TestRecordReplay(t *testing.T) {
+	mock := NewMock(&trezor.Getter{})
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{Message: proto.String("PONG")})
+	recorder := NewRecorder(mock, &trezor.Getter{})
+
+	ping := frame(t, "Ping", &trezor.Ping{Message: proto.String("PONG")})
+	if err := recorder.Write(ping); err != nil {
+		t.Fatal(err)
+	}
+	if _, msgType, _, err := recorder.Read(); err != nil || msgType != 2 {
+		t.Fatalf("unexpected reply %d %v", msgType, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ping.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Frames) != 2 {
+		t.Fatalf("expected 2 frames, received %+v", cassette.Frames)
+	}
+	if f := cassette.Frames[0]; f.Direction != Sent || f.Type != "Ping" || f.Time.IsZero() || !strings.Contains(string(f.Message), `"PONG"`) {
+		t.Errorf("unexpected frame %+v", f)
+	}
+	if f := cassette.Frames[1]; f.Direction != Received || f.Type != "Success" || f.TypeID != 2 {
+		t.Errorf("unexpected frame %+v", f)
+	}
+
+	replayer := NewReplayer(cassette)
+	if _, _, _, err = replayer.Read(); !errors.Is(err, ErrProtocol) {
+		t.Errorf("expected reading before writing to fail, received %v", err)
+	}
+	if err = replayer.Write(frame(t, "Ping", &trezor.Ping{Message: proto.String("PING")})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("expected a different payload to fail, received %v", err)
+	}
+	if err = replayer.Write(ping); err != nil {
+		t.Fatal(err)
+	}
+	marshalled, msgType, _, err := replayer.Read()
+	var success trezor.Success
+	if err != nil || msgType != 2 || proto.Unmarshal(marshalled, &success) != nil || success.GetMessage() != "PONG" {
+		t.Errorf("unexpected replayed reply %d %v %v", msgType, success, err)
+	}
+	if _, _, _, err = replayer.Read(); !errors.Is(err, ErrCassetteEnd) || replayer.Pending() != 0 {
+		t.Errorf("expected the end of the cassette, received %v", err)
+	}
+}
+
+func TestRecordSecrets(t *testing.T) {
+	mock := NewMock(&trezor.Getter{})
+	mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{})
+	recorder := NewRecorder(mock, &trezor.Getter{})
+
+	if err := recorder.Write(frame(t, "PinMatrixAck", &trezor.PinMatrixAck{Pin: proto.String("1234")})); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := recorder.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	cassette := recorder.Cassette()
+	f := cassette.Frames[0]
+	if f.Payload != "" || strings.Contains(string(f.Message), "1234") || !strings.Contains(string(f.Message), Redacted) {
+		t.Errorf("expected the PIN to be redacted, received %+v", f)
+	}
+	if written, err := mock.Written(); err != nil || len(written) != 1 || !strings.Contains(written[0].String(), "1234") {
+		t.Errorf("expected the PIN to reach the device, written %v %v", written, err)
+	}
+
+	replayer := NewReplayer(cassette)
+	if err := replayer.Write(frame(t, "Ping", &trezor.Ping{})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("expected another message to fail, received %v", err)
+	}
+	if err := replayer.Write(frame(t, "PinMatrixAck", &trezor.PinMatrixAck{Pin: proto.String("5678")})); err != nil {
+		t.Errorf("expected any PIN to be replayed, received %v", err)
+	}
+}
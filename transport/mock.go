@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/conejoninja/cerrojo/pb/common"
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrMockExhausted is returned by Mock.Read when no scripted reply is left.
+var ErrMockExhausted = errors.New("mock: no reply scripted")
+
+// Mock is an in-memory Transport for tests. It records every message written
+// to it and answers reads with scripted replies, in order.
+type Mock struct {
+	mu       sync.Mutex
+	messages common.Messager
+	frames   []MockFrame
+	replies  []MockFrame
+	closed   bool
+}
+
+// MockFrame is a message written to or scripted on a Mock.
+type MockFrame struct {
+	Type    common.MessageType
+	Payload []byte
+	timeout bool
+}
+
+// NewMock returns a Mock that decodes messages with the given device messages,
+// e.g. &trezor.Getter{}.
+func NewMock(messages common.Messager) *Mock {
+	return &Mock{messages: messages}
+}
+
+// Reply scripts msg as the next reply of the device.
+func (t *Mock) Reply(msgType common.MessageType, msg proto.Message) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replies = append(t.replies, MockFrame{Type: msgType, Payload: payload})
+	return nil
+}
+
+// Timeout scripts n reads timing out, as a device does while waiting for the
+// user.
+func (t *Mock) Timeout(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := 0; i < n; i++ {
+		t.replies = append(t.replies, MockFrame{Type: TimeoutError, timeout: true})
+	}
+}
+
+// Pending returns how many scripted replies have not been read yet.
+func (t *Mock) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.replies)
+}
+
+// Frames returns the messages written so far.
+func (t *Mock) Frames() []MockFrame {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	frames := make([]MockFrame, len(t.frames))
+	copy(frames, t.frames)
+	return frames
+}
+
+// Written returns the messages written so far decoded as their common.*
+// interface types, e.g. common.GetAddresser.
+func (t *Mock) Written() ([]proto.Message, error) {
+	frames := t.Frames()
+	msgs := make([]proto.Message, len(frames))
+	for i, f := range frames {
+		msg := common.NewMessage(t.messages, f.Type)
+		if msg == nil {
+			return msgs, errors.New("mock: unknown message type written")
+		}
+		if err := proto.Unmarshal(f.Payload, msg); err != nil {
+			return msgs, err
+		}
+		msgs[i] = msg
+	}
+	return msgs, nil
+}
+
+// Write records msg, it fails once the Mock is closed.
+func (t *Mock) Write(msg []byte) error {
+	// 35 : '#' magic header
+	if len(msg) < 8 || msg[0] != 35 || msg[1] != 35 {
+		return &Error{Kind: ProtocolError, Err: errors.New("mock: no magic header")}
+	}
+	msgType := binary.BigEndian.Uint16(msg[2:4])
+	msgLength := int(binary.BigEndian.Uint32(msg[4:8]))
+	if msgLength > len(msg)-8 {
+		msgLength = len(msg) - 8
+	}
+	payload := make([]byte, msgLength)
+	copy(payload, msg[8:8+msgLength])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return &Error{Kind: DisconnectedError, Err: errors.New("no such device")}
+	}
+	t.frames = append(t.frames, MockFrame{Type: common.MessageType(msgType), Payload: payload})
+	return nil
+}
+
+func (t *Mock) Read() ([]byte, uint16, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, DisconnectedError, 0, &Error{Kind: DisconnectedError, Err: errors.New("no such device")}
+	}
+	if len(t.replies) == 0 {
+		return nil, DisconnectedError, 0, &Error{Kind: DisconnectedError, Err: ErrMockExhausted}
+	}
+	reply := t.replies[0]
+	t.replies = t.replies[1:]
+	if reply.timeout {
+		return nil, TimeoutError, 0, ErrTimeout
+	}
+	return reply.Payload, uint16(reply.Type), len(reply.Payload), nil
+}
+
+func (t *Mock) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
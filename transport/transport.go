@@ -1,14 +1,147 @@
 package transport
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/conejoninja/cerrojo/transport/wire"
+)
+
 type Transport interface {
-	Write([]byte)
+	Write([]byte) error
 	Read() ([]byte, uint16, int, error)
 	Close()
 }
 
+// ContextWriter is implemented by transports whose Write blocks until the
+// device answers, like Bridge, so a call given up on does not stay blocked.
+type ContextWriter interface {
+	WriteContext(ctx context.Context, msg []byte) error
+}
+
 const (
 	TimeoutError = iota + 999
 	ProtocolError
 	EndpointError
 	DisconnectedError
-)
\ No newline at end of file
+)
+
+var (
+	ErrTimeout      = &Error{Kind: TimeoutError}
+	ErrProtocol     = &Error{Kind: ProtocolError}
+	ErrEndpoint     = &Error{Kind: EndpointError}
+	ErrDisconnected = &Error{Kind: DisconnectedError}
+)
+
+// Error is a transport failure. Kind is one of TimeoutError, ProtocolError,
+// EndpointError or DisconnectedError, the same value Read returns as message
+// type. Check it with errors.Is(err, transport.ErrDisconnected) and the like.
+type Error struct {
+	Kind uint16
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	switch e.Kind {
+	case TimeoutError:
+		return "timeout"
+	case ProtocolError:
+		return "protocol error"
+	case EndpointError:
+		return "endpoint error"
+	case DisconnectedError:
+		return "device disconnected"
+	}
+	return fmt.Sprintf("transport error %d", e.Kind)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same Kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// ErrorKind returns the Kind of a transport error, or 0 if err is not one.
+func ErrorKind(err error) uint16 {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return 0
+}
+
+// writeReports sends msg in reports, failing on the first report that is not
+// fully written.
+func writeReports(msg []byte, write func([]byte) (int, error), classify func(error) *Error) error {
+	reports := wire.Split(msg)
+	for i, report := range reports {
+		n, err := write(report)
+		if err == nil && n < len(report) {
+			return &Error{Kind: EndpointError, Err: fmt.Errorf("short write: report %d of %d", i+1, len(reports))}
+		}
+		if err != nil {
+			e := classify(err)
+			e.Err = fmt.Errorf("report %d of %d: %w", i+1, len(reports), err)
+			return e
+		}
+	}
+	return nil
+}
+
+// partialTimeout is how long readMessage waits for the next report of a
+// message it has started to read.
+var partialTimeout = 5 * time.Second
+
+// readMessage reassembles a message from the reports returned by read. Read
+// timeouts in the middle of a message are retried for up to partialTimeout,
+// then the message is given up as truncated.
+func readMessage(read func() ([]byte, error), classify func(error) *Error) ([]byte, uint16, int, error) {
+	var d wire.Decoder
+	var last time.Time
+	buf, err := read()
+	for {
+		if err != nil {
+			if e := classify(err); !d.Started() || e.Kind != TimeoutError {
+				return nil, e.Kind, 0, e
+			}
+			if time.Since(last) >= partialTimeout {
+				return nil, ProtocolError, 0, &Error{Kind: ProtocolError, Err: fmt.Errorf("truncated message: %w", err)}
+			}
+		} else {
+			last = time.Now()
+			done, err := d.Write(buf)
+			if err != nil {
+				return nil, ProtocolError, 0, &Error{Kind: ProtocolError, Err: err}
+			}
+			if done {
+				msgType, marshalled := d.Message()
+				return marshalled, msgType, len(marshalled), nil
+			}
+		}
+		buf, err = read()
+	}
+}
+
+// classify maps the errors of the USB HID libraries to transport errors.
+func classify(err error) *Error {
+	switch {
+	case errors.Is(err, syscall.EPROTO):
+		return &Error{Kind: ProtocolError, Err: err}
+	case errors.Is(err, syscall.ESHUTDOWN):
+		return &Error{Kind: EndpointError, Err: err}
+	case errors.Is(err, syscall.ENODEV), errors.Is(err, syscall.EBADF):
+		return &Error{Kind: DisconnectedError, Err: err}
+	default:
+		return &Error{Kind: TimeoutError, Err: err}
+	}
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/conejoninja/cerrojo/transport/wire"
+)
+
+func TestReadMessageTruncated(t *testing.T) {
+	defer func(d time.Duration) { partialTimeout = d }(partialTimeout)
+	partialTimeout = 50 * time.Millisecond
+
+	// the device stops answering after the first report of a message
+	reports := wire.Encode(17, make([]byte, 150))[:1]
+	read := func() ([]byte, error) {
+		if len(reports) == 0 {
+			time.Sleep(10 * time.Millisecond)
+			return nil, syscall.ETIMEDOUT
+		}
+		report := reports[0]
+		reports = reports[1:]
+		return report, nil
+	}
+	var msgType uint16
+	var err error
+	done := make(chan struct{})
+	go func() {
+		_, msgType, _, err = readMessage(read, classify)
+		close(done)
+	}()
+	select {
+	case <-done:
+		if msgType != ProtocolError || !errors.Is(err, ErrProtocol) || !errors.Is(err, syscall.ETIMEDOUT) {
+			t.Errorf("expected a truncated message, received %d %v", msgType, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("readMessage kept waiting for the rest of the message")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for err, kind := range map[error]uint16{
+		syscall.EPROTO:    ProtocolError,
+		syscall.ESHUTDOWN: EndpointError,
+		syscall.ENODEV:    DisconnectedError,
+		syscall.EBADF:     DisconnectedError,
+		syscall.ETIMEDOUT: TimeoutError,
+	} {
+		if e := classify(err); e.Kind != kind || !errors.Is(e, err) {
+			t.Errorf("%v: expected kind %d, received %d", err, kind, e.Kind)
+		}
+	}
+}
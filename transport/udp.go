@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/conejoninja/cerrojo/transport/wire"
+)
+
+// DefaultUDPAddress is where the TREZOR emulator listens by default.
+const DefaultUDPAddress = "127.0.0.1:21324"
+
+// UDP talks to the TREZOR emulator, which speaks the same 64-byte framed
+// protocol as the HID devices, one datagram per report.
+type UDP struct {
+	conn *net.UDPConn
+}
+
+func (t *UDP) SetAddress(address string) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	return nil
+}
+
+// Ping checks that the emulator is listening, it answers PINGPING with
+// PONGPONG.
+func (t *UDP) Ping() bool {
+	if _, err := t.conn.Write([]byte("PINGPING")); err != nil {
+		return false
+	}
+	buf := make([]byte, 64)
+	t.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	n, err := t.conn.Read(buf)
+	return err == nil && bytes.Equal(buf[:n], []byte("PONGPONG"))
+}
+
+func (t *UDP) Close() {
+	t.conn.Close()
+}
+
+func (t *UDP) Write(msg []byte) error {
+	if t.conn == nil {
+		return ErrDisconnected
+	}
+	return writeReports(msg, t.conn.Write, udpError)
+}
+
+func (t *UDP) Read() ([]byte, uint16, int, error) {
+	timeout := 100 * time.Millisecond
+	return readMessage(func() ([]byte, error) {
+		buf, err := t.readReport(timeout)
+		timeout = 1 * time.Second
+		return buf, err
+	}, udpError)
+}
+
+func (t *UDP) readReport(timeout time.Duration) ([]byte, error) {
+	buf := make([]byte, wire.ReportSize)
+	t.conn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := t.conn.Read(buf)
+	return buf[:n], err
+}
+
+func udpError(err error) *Error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &Error{Kind: TimeoutError, Err: err}
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, net.ErrClosed) {
+		return &Error{Kind: DisconnectedError, Err: err}
+	}
+	return &Error{Kind: EndpointError, Err: err}
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// emulator answers every request with a message of type 17 carrying payload,
+// framed in 64-byte reports like the TREZOR emulator does.
+func emulator(t *testing.T, payload []byte) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if bytes.Equal(buf[:n], []byte("PINGPING")) {
+				conn.WriteToUDP([]byte("PONGPONG"), addr)
+				continue
+			}
+			if n != 64 || buf[0] != 63 || buf[1] != 35 {
+				continue
+			}
+
+			msg := []byte{35, 35, 0, 17, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(msg[4:8], uint32(len(payload)))
+			msg = append(msg, payload...)
+			for len(msg) > 0 {
+				report := make([]byte, 64)
+				report[0] = 63
+				l := copy(report[1:], msg)
+				msg = msg[l:]
+				conn.WriteToUDP(report, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestUDP(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 15)
+	var udp UDP
+	if err := udp.SetAddress(emulator(t, payload)); err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	if !udp.Ping() {
+		t.Fatal("emulator did not answer PINGPING")
+	}
+
+	if err := udp.Write([]byte{35, 35, 0, 55, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	marshalled, msgType, msgLength, err := udp.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != 17 || msgLength != len(payload) || !bytes.Equal(marshalled, payload) {
+		t.Errorf("unexpected reply type %d length %d: %q", msgType, msgLength, marshalled)
+	}
+
+	if _, msgType, _, err = udp.Read(); err == nil || msgType != TimeoutError {
+		t.Errorf("expected a timeout, received %d %v", msgType, err)
+	}
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"github.com/conejoninja/cerrojo/transport/wire"
+	"github.com/karalabe/usb"
+)
+
+// WebUSB talks to devices exposing a vendor-class (WebUSB) interface instead
+// of a HID one, like the TREZOR Model T and newer bootloaders. It claims the
+// interface through libusb and sends the same 64-byte reports as the HID
+// transports with interrupt transfers.
+type WebUSB struct {
+	device usb.Device
+}
+
+// NewWebUSB opens the raw USB device described by devInfo, as listed by
+// usb.EnumerateRaw.
+func NewWebUSB(devInfo usb.DeviceInfo) (*WebUSB, error) {
+	dev, err := devInfo.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &WebUSB{device: dev}, nil
+}
+
+// SetDevice uses an already open device.
+func (t *WebUSB) SetDevice(device usb.Device) {
+	t.device = device
+}
+
+func (t *WebUSB) Close() {
+	if t.device != nil {
+		t.device.Close()
+	}
+}
+
+func (t *WebUSB) Write(msg []byte) error {
+	if t.device == nil {
+		return ErrDisconnected
+	}
+	return writeReports(msg, t.device.Write, usbError)
+}
+
+func (t *WebUSB) Read() ([]byte, uint16, int, error) {
+	if t.device == nil {
+		return nil, DisconnectedError, 0, ErrDisconnected
+	}
+	return readMessage(func() ([]byte, error) {
+		buf := make([]byte, wire.ReportSize)
+		n, err := t.device.Read(buf)
+		return buf[:n], err
+	}, usbError)
+}
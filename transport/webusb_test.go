@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/cerrojo/transport/wire"
+	"github.com/karalabe/usb"
+)
+
+// fakeUSB stands in for a libusb device, it records the written transfers
+// and answers reads with queued ones.
+type fakeUSB struct {
+	written   [][]byte
+	reads     [][]byte
+	maxWrites int
+	short     bool
+	readErr   error
+	closed    bool
+}
+
+func (d *fakeUSB) Write(b []byte) (int, error) {
+	if d.closed {
+		return 0, usb.ErrDeviceClosed
+	}
+	if d.maxWrites > 0 && len(d.written) == d.maxWrites {
+		return 0, nil
+	}
+	d.written = append(d.written, append([]byte{}, b...))
+	if d.short {
+		return len(b) / 2, nil
+	}
+	return len(b), nil
+}
+
+func (d *fakeUSB) Read(b []byte) (int, error) {
+	if d.readErr != nil {
+		return 0, d.readErr
+	}
+	if d.closed || len(d.reads) == 0 {
+		return 0, usb.ErrDeviceClosed
+	}
+	n := copy(b, d.reads[0])
+	d.reads = d.reads[1:]
+	return n, nil
+}
+
+func (d *fakeUSB) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestWebUSB(t *testing.T) {
+	device := &fakeUSB{}
+	var webusb WebUSB
+	webusb.SetDevice(device)
+
+	payload := bytes.Repeat([]byte("0123456789"), 15)
+	if err := webusb.Write(append(wire.Header(29, len(payload)), payload...)); err != nil {
+		t.Fatal(err)
+	}
+	if len(device.written) != 3 {
+		t.Fatalf("expected 3 transfers, received %d", len(device.written))
+	}
+	var sent []byte
+	for i, transfer := range device.written {
+		if len(transfer) != wire.ReportSize || transfer[0] != wire.ReportID {
+			t.Fatalf("unexpected transfer %d % x", i, transfer)
+		}
+		sent = append(sent, transfer[1:]...)
+	}
+	if !bytes.Equal(sent[wire.HeaderSize:wire.HeaderSize+len(payload)], payload) {
+		t.Errorf("unexpected payload sent %q", sent)
+	}
+
+	device.reads = wire.Encode(17, payload)
+	marshalled, msgType, msgLength, err := webusb.Read()
+	if err != nil || msgType != 17 || msgLength != len(payload) || !bytes.Equal(marshalled, payload) {
+		t.Errorf("unexpected reply %q %d %d %v", marshalled, msgType, msgLength, err)
+	}
+}
+
+func TestWebUSBErrors(t *testing.T) {
+	payload := bytes.Repeat([]byte{1}, 150)
+
+	device := &fakeUSB{maxWrites: 1}
+	webusb := WebUSB{device: device}
+	err := webusb.Write(append(wire.Header(29, len(payload)), payload...))
+	if !errors.Is(err, ErrEndpoint) || !strings.Contains(err.Error(), "report 2 of 3") {
+		t.Errorf("expected a short write on report 2, received %v", err)
+	}
+	device = &fakeUSB{short: true}
+	webusb = WebUSB{device: device}
+	err = webusb.Write(append(wire.Header(29, len(payload)), payload...))
+	if !errors.Is(err, ErrEndpoint) || !strings.Contains(err.Error(), "report 1 of 3") {
+		t.Errorf("expected a partial write on report 1, received %v", err)
+	}
+
+	// unplugged in the middle of a reply
+	device = &fakeUSB{reads: wire.Encode(17, payload)[:1]}
+	webusb = WebUSB{device: device}
+	if _, msgType, _, err := webusb.Read(); msgType != DisconnectedError || !errors.Is(err, ErrDisconnected) || !errors.Is(err, usb.ErrDeviceClosed) {
+		t.Errorf("expected a disconnection, received %d %v", msgType, err)
+	}
+
+	// the errors hidapi and libusb return for an unplugged device
+	for _, readErr := range []error{
+		errors.New("hidapi: Input/output error"),
+		fmt.Errorf("failed to read from device: %v", "no device"),
+	} {
+		device = &fakeUSB{readErr: readErr}
+		webusb = WebUSB{device: device}
+		if _, msgType, _, err := webusb.Read(); msgType != DisconnectedError || !errors.Is(err, readErr) {
+			t.Errorf("expected a disconnection, received %d %v", msgType, err)
+		}
+	}
+
+	// garbage instead of a header
+	device = &fakeUSB{reads: [][]byte{make([]byte, wire.ReportSize)}}
+	webusb = WebUSB{device: device}
+	if _, msgType, _, err := webusb.Read(); msgType != ProtocolError || !errors.Is(err, wire.ErrNoHeader) {
+		t.Errorf("expected a protocol error, received %d %v", msgType, err)
+	}
+
+	webusb.Close()
+	if err = webusb.Write([]byte{35, 35, 0, 0, 0, 0, 0, 0}); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("expected a disconnection after close, received %v", err)
+	}
+}
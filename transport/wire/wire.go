@@ -0,0 +1,129 @@
+// Package wire implements the framing shared by the TREZOR and KeepKey
+// transports: a message is a "##" magic, a 2-byte type, a 4-byte length and
+// the protobuf payload, sent in 64-byte reports starting with a '?' report ID.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// ReportSize is the size of every report sent to the device.
+	ReportSize = 64
+	// ReportID starts every report.
+	ReportID = 63 // '?'
+	// Magic starts every message.
+	Magic = 35 // '#'
+	// HeaderSize is the size of the magic, type and length of a message.
+	HeaderSize = 8
+)
+
+var (
+	// ErrNoHeader is returned when the first report of a message has no
+	// "##" magic header.
+	ErrNoHeader = errors.New("wire: no magic header")
+	// ErrDone is returned when writing to a Decoder holding a complete
+	// message.
+	ErrDone = errors.New("wire: message already complete")
+)
+
+// Header returns the magic header of a message of msgType with length bytes
+// of payload.
+func Header(msgType uint16, length int) []byte {
+	header := make([]byte, HeaderSize)
+	header[0], header[1] = Magic, Magic
+	binary.BigEndian.PutUint16(header[2:4], msgType)
+	binary.BigEndian.PutUint32(header[4:8], uint32(length))
+	return header
+}
+
+// Encode frames payload as a msgType message and splits it into reports.
+func Encode(msgType uint16, payload []byte) [][]byte {
+	return Split(append(Header(msgType, len(payload)), payload...))
+}
+
+// Split splits an already framed message, magic header included, into
+// zero-padded reports.
+func Split(msg []byte) [][]byte {
+	var reports [][]byte
+	for len(msg) > 0 {
+		report := make([]byte, ReportSize)
+		report[0] = ReportID
+		l := copy(report[1:], msg)
+		msg = msg[l:]
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Decoder reassembles a message from the reports read from the device.
+type Decoder struct {
+	msgType uint16
+	length  int
+	payload []byte
+	started bool
+}
+
+// Write adds a report to the message and reports whether it is complete.
+// The magic header is looked for anywhere in the first report, following
+// reports carry payload after their report ID.
+func (d *Decoder) Write(report []byte) (bool, error) {
+	if d.Done() {
+		return true, ErrDone
+	}
+	if !d.started {
+		i := 0
+		for ; i+HeaderSize <= len(report); i++ {
+			if report[i] == Magic && report[i+1] == Magic {
+				break
+			}
+		}
+		if i+HeaderSize > len(report) {
+			return false, ErrNoHeader
+		}
+		d.started = true
+		d.msgType = binary.BigEndian.Uint16(report[i+2 : i+4])
+		d.length = int(binary.BigEndian.Uint32(report[i+4 : i+8]))
+		d.payload = make([]byte, 0, minInt(d.length, 1<<16))
+		d.add(report[i+HeaderSize:])
+		return d.Done(), nil
+	}
+
+	if len(report) > 0 {
+		d.add(report[1:])
+	}
+	return d.Done(), nil
+}
+
+func (d *Decoder) add(data []byte) {
+	l := minInt(len(data), d.length-len(d.payload))
+	d.payload = append(d.payload, data[:l]...)
+}
+
+// Started reports whether the magic header has been read.
+func (d *Decoder) Started() bool {
+	return d.started
+}
+
+// Done reports whether the whole message has been read.
+func (d *Decoder) Done() bool {
+	return d.started && len(d.payload) == d.length
+}
+
+// Message returns the message type and its payload.
+func (d *Decoder) Message() (uint16, []byte) {
+	return d.msgType, d.payload
+}
+
+// Reset prepares the decoder for the next message.
+func (d *Decoder) Reset() {
+	*d = Decoder{}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType uint16
+		payload []byte
+		reports int
+	}{
+		{"empty", 0, nil, 1},
+		{"short", 1, []byte("PING"), 1},
+		{"one report", 17, bytes.Repeat([]byte{1}, 55), 1},
+		{"one more byte", 17, bytes.Repeat([]byte{1}, 56), 2},
+		{"two reports", 26, bytes.Repeat([]byte{2}, 55+63), 2},
+		{"many reports", 7, bytes.Repeat([]byte{3}, 1000), 16},
+	}
+	for _, tt := range tests {
+		reports := Encode(tt.msgType, tt.payload)
+		if len(reports) != tt.reports {
+			t.Errorf("%s: expected %d reports, received %d", tt.name, tt.reports, len(reports))
+		}
+		for _, r := range reports {
+			if len(r) != ReportSize || r[0] != ReportID {
+				t.Errorf("%s: malformed report %v", tt.name, r)
+			}
+		}
+
+		var d Decoder
+		for i, r := range reports {
+			done, err := d.Write(r)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if done != (i == len(reports)-1) {
+				t.Errorf("%s: report %d done=%v", tt.name, i, done)
+			}
+		}
+		msgType, payload := d.Message()
+		if msgType != tt.msgType || !bytes.Equal(payload, tt.payload) {
+			t.Errorf("%s: decoded type %d payload %v", tt.name, msgType, payload)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports [][]byte
+		done    bool
+		err     error
+		msgType uint16
+		payload []byte
+	}{
+		{"no header", [][]byte{{63, 1, 2, 3}}, false, ErrNoHeader, 0, nil},
+		{"magic on last byte", [][]byte{{63, 0, 0, 35}}, false, ErrNoHeader, 0, nil},
+		{"truncated header", [][]byte{{63, 35, 35, 0, 2, 0, 0}}, false, ErrNoHeader, 0, nil},
+		{"header without report ID", [][]byte{{35, 35, 0, 2, 0, 0, 0, 1, 9}}, true, nil, 2, []byte{9}},
+		{"short continuation", [][]byte{{63, 35, 35, 0, 2, 0, 0, 0, 3, 9}, {63, 8}, {63, 7, 6, 5}}, true, nil, 2, []byte{9, 8, 7}},
+		{"empty continuation", [][]byte{{63, 35, 35, 0, 2, 0, 0, 0, 2, 9}, {}, {63, 8}}, true, nil, 2, []byte{9, 8}},
+		{"after done", [][]byte{{63, 35, 35, 0, 2, 0, 0, 0, 0}, {63, 1}}, true, ErrDone, 2, []byte{}},
+	}
+	for _, tt := range tests {
+		var d Decoder
+		var done bool
+		var err error
+		for _, r := range tt.reports {
+			if done, err = d.Write(r); err != nil {
+				break
+			}
+		}
+		if done != tt.done || err != tt.err {
+			t.Errorf("%s: expected done=%v err=%v, received done=%v err=%v", tt.name, tt.done, tt.err, done, err)
+			continue
+		}
+		if msgType, payload := d.Message(); tt.done && (msgType != tt.msgType || !bytes.Equal(payload, tt.payload)) {
+			t.Errorf("%s: decoded type %d payload %v", tt.name, msgType, payload)
+		}
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add(uint16(17), []byte("features"), []byte{63, 35, 35, 0, 1, 0, 0, 0, 200})
+	f.Add(uint16(0), []byte{}, []byte{35})
+	f.Fuzz(func(t *testing.T, msgType uint16, payload []byte, garbage []byte) {
+		var d Decoder
+		for _, r := range Encode(msgType, payload) {
+			if _, err := d.Write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		gotType, gotPayload := d.Message()
+		if !d.Done() || gotType != msgType || !bytes.Equal(gotPayload, payload) {
+			t.Fatalf("round trip failed: %d %v", gotType, gotPayload)
+		}
+
+		// arbitrary reports must never panic
+		d.Reset()
+		for len(garbage) > 0 {
+			l := minInt(len(garbage), ReportSize)
+			d.Write(garbage[:l])
+			garbage = garbage[l:]
+		}
+	})
+}
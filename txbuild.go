@@ -0,0 +1,77 @@
+package cerrojo
+
+import (
+	"github.com/conejoninja/cerrojo/bitcoin/script"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// ScriptType is the kind of single key script an input spends or a change
+// output pays to, see script.Type.
+type ScriptType = script.Type
+
+// The single key script types, see script.P2PKH, script.P2SHP2WPKH and
+// script.P2WPKH.
+const (
+	P2PKH      = script.P2PKH
+	P2SHP2WPKH = script.P2SHP2WPKH
+	P2WPKH     = script.P2WPKH
+)
+
+// ScriptTypeForPath returns the script type of the account path belongs to
+// from its BIP-44, BIP-49 or BIP-84 purpose, P2PKH for other paths.
+func ScriptTypeForPath(path []uint32) ScriptType {
+	return script.ForPath(path)
+}
+
+// NewInput builds an input spending output prevIndex of the transaction
+// prevHash, in display order, with the key at path. amount is the value of
+// the spent output, segwit inputs are signed over it so it is required for
+// P2SHP2WPKH and P2WPKH.
+func NewInput(tp types.Typer, scriptType ScriptType, path []uint32, prevHash []byte, prevIndex uint32, amount uint64) types.TxInputTyper {
+	input := tp.GetTxInputType()
+	st := tp.GetInputScriptType()
+	types.SetEnum(st, int32(scriptType.InputScriptType()))
+	input.SetScriptType(st)
+	input.SetAddressN(path)
+	input.SetPrevHash(prevHash)
+	input.SetPrevIndex(&prevIndex)
+	if amount != 0 {
+		input.SetAmount(&amount)
+	}
+	return input
+}
+
+// NewOutput builds an output paying amount to addr.
+func NewOutput(tp types.Typer, addr string, amount uint64) types.TxOutputTyper {
+	output := tp.GetTxOutputType()
+	st := tp.GetOutputScriptType()
+	types.SetEnum(st, int32(types.OutputScriptType_PAYTOADDRESS))
+	output.SetScriptType(st)
+	output.SetAddress(&addr)
+	output.SetAmount(&amount)
+	return output
+}
+
+// NewChangeOutput builds an output paying amount back to the key at path.
+// The device derives the address itself and does not ask to confirm it.
+func NewChangeOutput(tp types.Typer, scriptType ScriptType, path []uint32, amount uint64) types.TxOutputTyper {
+	output := tp.GetTxOutputType()
+	st := tp.GetOutputScriptType()
+	types.SetEnum(st, int32(scriptType.OutputScriptType()))
+	output.SetScriptType(st)
+	output.SetAddressN(path)
+	output.SetAmount(&amount)
+	return output
+}
+
+// NewOpReturnOutput builds a zero value OP_RETURN output carrying data.
+func NewOpReturnOutput(tp types.Typer, data []byte) types.TxOutputTyper {
+	var amount uint64
+	output := tp.GetTxOutputType()
+	st := tp.GetOutputScriptType()
+	types.SetEnum(st, int32(types.OutputScriptType_PAYTOOPRETURN))
+	output.SetScriptType(st)
+	output.SetOpReturnData(data)
+	output.SetAmount(&amount)
+	return output
+}
@@ -0,0 +1,57 @@
+package cerrojo
+
+import (
+	"bytes"
+	"testing"
+
+	keepkey "github.com/conejoninja/cerrojo/pb/keepkey/types"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/types"
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+func TestScriptTypeForPath(t *testing.T) {
+	for path, expected := range map[string]ScriptType{
+		"m/44'/0'/0'/0/0": P2PKH,
+		"m/49'/0'/0'/1/3": P2SHP2WPKH,
+		"m/84'/1'/2'/0/0": P2WPKH,
+		"m/0/1":           P2PKH,
+		"m":               P2PKH,
+	} {
+		if got := ScriptTypeForPath(StringToBIP32Path(path)); got != expected {
+			t.Errorf("%s: expected %d, received %d", path, expected, got)
+		}
+	}
+}
+
+func TestNewChangeOutput(t *testing.T) {
+	path := StringToBIP32Path("m/49'/0'/0'/1/3")
+	for _, tp := range []types.Typer{&trezor.Getter{}, &keepkey.Getter{}} {
+		for scriptType, expected := range map[ScriptType]types.OutputScriptType{
+			P2PKH:      types.OutputScriptType_PAYTOADDRESS,
+			P2SHP2WPKH: types.OutputScriptType_PAYTOP2SHWITNESS,
+			P2WPKH:     types.OutputScriptType_PAYTOWITNESS,
+		} {
+			output := NewChangeOutput(tp, scriptType, path, 5000)
+			if types.OutputScriptTyper2Type(output.GetScriptType()) != expected || output.GetAmount() != 5000 || output.GetAddress() != "" {
+				t.Errorf("unexpected change output %v", output)
+			}
+			if len(output.GetAddressN()) != len(path) || output.GetAddressN()[3] != 1 {
+				t.Errorf("unexpected change path %v", output.GetAddressN())
+			}
+		}
+	}
+}
+
+func TestNewInput(t *testing.T) {
+	prevHash := bytes.Repeat([]byte{1}, 32)
+	for _, tp := range []types.Typer{&trezor.Getter{}, &keepkey.Getter{}} {
+		input := NewInput(tp, P2SHP2WPKH, StringToBIP32Path("m/49'/0'/0'/0/0"), prevHash, 2, 1000)
+		if types.InputScriptTyper2Type(input.GetScriptType()) != types.InputScriptType_SPENDP2SHWITNESS || input.GetAmount() != 1000 || input.GetPrevIndex() != 2 || !bytes.Equal(input.GetPrevHash(), prevHash) {
+			t.Errorf("unexpected input %v", input)
+		}
+		output := NewOpReturnOutput(tp, []byte("cerrojo"))
+		if types.OutputScriptTyper2Type(output.GetScriptType()) != types.OutputScriptType_PAYTOOPRETURN || string(output.GetOpReturnData()) != "cerrojo" {
+			t.Errorf("unexpected OP_RETURN output %v", output)
+		}
+	}
+}
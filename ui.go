@@ -0,0 +1,111 @@
+package cerrojo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/conejoninja/cerrojo/pb/types"
+)
+
+// UI answers the interactive requests the device sends in the middle of a
+// call. When a UI is installed with SetUI, CallMessage (and Call) reply to
+// PinMatrixRequest, PassphraseRequest, ButtonRequest and WordRequest by
+// themselves and only return the final reply. Returning an error cancels the
+// current action on the device.
+type UI interface {
+	RequestPin(t types.PinMatrixRequestType) (string, error)
+	RequestPassphrase() (string, error)
+	ButtonRequest(code types.ButtonRequestType) error
+	RequestWord(t types.WordRequestType) (string, error)
+}
+
+// ErrScriptExhausted is returned by ScriptedUI when it has no answer left.
+var ErrScriptExhausted = errors.New("scripted UI has no answer left")
+
+// TerminalUI asks for PIN, passphrase and words on a terminal, one line each.
+type TerminalUI struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func NewTerminalUI(in io.Reader, out io.Writer) *TerminalUI {
+	return &TerminalUI{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+func (u *TerminalUI) RequestPin(t types.PinMatrixRequestType) (string, error) {
+	switch t {
+	case types.PinMatrixRequestType_PinMatrixRequestType_NewFirst:
+		fmt.Fprintln(u.out, "Please enter new PIN:")
+	case types.PinMatrixRequestType_PinMatrixRequestType_NewSecond:
+		fmt.Fprintln(u.out, "Please re-enter new PIN:")
+	default:
+		fmt.Fprintln(u.out, "Please enter current PIN:")
+	}
+	fmt.Fprintln(u.out, "Use the numeric keypad layout, the device shows the digits")
+	fmt.Fprintln(u.out, "  7 8 9\n  4 5 6\n  1 2 3")
+	return u.readLine()
+}
+
+func (u *TerminalUI) RequestPassphrase() (string, error) {
+	fmt.Fprintln(u.out, "Enter your passphrase")
+	return u.readLine()
+}
+
+func (u *TerminalUI) ButtonRequest(code types.ButtonRequestType) error {
+	fmt.Fprintln(u.out, "Confirm action on device")
+	return nil
+}
+
+func (u *TerminalUI) RequestWord(t types.WordRequestType) (string, error) {
+	fmt.Fprintln(u.out, "Enter the word")
+	return u.readLine()
+}
+
+func (u *TerminalUI) readLine() (string, error) {
+	line, err := u.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ScriptedUI answers with pre-recorded values, in order, for tests. Button
+// requests are always confirmed and recorded in Buttons.
+type ScriptedUI struct {
+	Pins        []string
+	Passphrases []string
+	Words       []string
+	Buttons     []types.ButtonRequestType
+}
+
+func (u *ScriptedUI) RequestPin(t types.PinMatrixRequestType) (string, error) {
+	return pop(&u.Pins)
+}
+
+func (u *ScriptedUI) RequestPassphrase() (string, error) {
+	return pop(&u.Passphrases)
+}
+
+func (u *ScriptedUI) ButtonRequest(code types.ButtonRequestType) error {
+	u.Buttons = append(u.Buttons, code)
+	return nil
+}
+
+func (u *ScriptedUI) RequestWord(t types.WordRequestType) (string, error) {
+	return pop(&u.Words)
+}
+
+func pop(answers *[]string) (string, error) {
+	if len(*answers) == 0 {
+		return "", ErrScriptExhausted
+	}
+	answer := (*answers)[0]
+	*answers = (*answers)[1:]
+	return answer, nil
+}
@@ -0,0 +1,129 @@
+package cerrojo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// EventType tells whether a device was connected or disconnected.
+type EventType int
+
+const (
+	Connected EventType = iota
+	Disconnected
+)
+
+func (t EventType) String() string {
+	if t == Connected {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// Event is sent by Watch when a device comes or goes.
+type Event struct {
+	Type   EventType
+	Device Descriptor
+}
+
+// WatchPeriod is how often Watch enumerates the devices.
+var WatchPeriod = 500 * time.Millisecond
+
+// Watch sends a Connected event for every device already connected, then an
+// event each time a device is connected or disconnected, until ctx is done.
+// Devices are told apart by their USB path.
+func Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	current := connected()
+	go func() {
+		defer close(events)
+		known := map[string]Descriptor{}
+		for {
+			for path, d := range known {
+				if _, ok := current[path]; !ok && !send(ctx, events, Event{Type: Disconnected, Device: d}) {
+					return
+				}
+			}
+			for path, d := range current {
+				if _, ok := known[path]; !ok && !send(ctx, events, Event{Type: Connected, Device: d}) {
+					return
+				}
+			}
+			known = current
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(WatchPeriod):
+			}
+			current = connected()
+		}
+	}()
+	return events
+}
+
+func connected() map[string]Descriptor {
+	descs := map[string]Descriptor{}
+	for _, d := range Enumerate() {
+		descs[d.Path] = d
+	}
+	return descs
+}
+
+func send(ctx context.Context, events chan<- Event, e Event) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ErrNoSerial is returned by Reattach for an empty serial, which would match
+// any device without one.
+var ErrNoSerial = errors.New("cerrojo: reattach needs the USB serial of the device")
+
+// Reattach watches for the device with the given USB serial and swaps the
+// Client transport for a new one each time the device is connected again,
+// until ctx is done. Calls failing while the device is away still fail.
+func (c *Client) Reattach(ctx context.Context, serial string) error {
+	if serial == "" {
+		return ErrNoSerial
+	}
+	away := true
+	for _, d := range Enumerate() {
+		if d.Serial == serial {
+			away = false
+		}
+	}
+	events := Watch(ctx)
+	// away is owned by the goroutine from here on
+	go func(away bool) {
+		for e := range events {
+			if e.Device.Serial != serial {
+				continue
+			}
+			if e.Type == Disconnected {
+				away = true
+				continue
+			}
+			if !away {
+				continue
+			}
+			t, err := e.Device.open()
+			if err != nil {
+				continue
+			}
+			away = false
+			c.mu.Lock()
+			old := c.t
+			c.t = t
+			c.mu.Unlock()
+			if old != nil {
+				old.Close()
+			}
+		}
+	}(away)
+	return nil
+}
@@ -0,0 +1,107 @@
+package cerrojo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conejoninja/cerrojo/devices"
+	"github.com/conejoninja/cerrojo/pb/common"
+	trezor "github.com/conejoninja/cerrojo/pb/trezor/messages"
+	"github.com/conejoninja/cerrojo/transport"
+	"github.com/golang/protobuf/proto"
+	"github.com/karalabe/usb"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func TestWatch(t *testing.T) {
+	one := usb.DeviceInfo{Path: "1-1:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "A1"}
+	two := usb.DeviceInfo{Path: "1-2:1.0", VendorID: 0x2b24, ProductID: 0x0001, Serial: "K1"}
+	bus.plug(one)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := Watch(ctx)
+	defer func() {
+		cancel()
+		for range events {
+		}
+	}()
+
+	if e := nextEvent(t, events); e.Type != Connected || e.Device.Serial != "A1" {
+		t.Errorf("unexpected event %v %+v", e.Type, e.Device)
+	}
+	bus.plug(one, two)
+	if e := nextEvent(t, events); e.Type != Connected || e.Device.Serial != "K1" || e.Device.Vendor != "KEEPKEY" {
+		t.Errorf("unexpected event %v %+v", e.Type, e.Device)
+	}
+	bus.plug(two)
+	if e := nextEvent(t, events); e.Type != Disconnected || e.Device.Serial != "A1" {
+		t.Errorf("unexpected event %v %+v", e.Type, e.Device)
+	}
+}
+
+func TestReattach(t *testing.T) {
+	one := usb.DeviceInfo{Path: "1-1:1.0", VendorID: 0x534c, ProductID: 0x0001, Serial: "A1"}
+	bus.plug(one)
+
+	d, _ := devices.GetDevice("trezor")
+	mocks := make(chan *transport.Mock, 1)
+	bus.onOpen(func(info usb.DeviceInfo) (transport.Transport, error) {
+		mock := transport.NewMock(d.Messages)
+		mock.Reply(common.MessageType_value["MessageType_MessageType_Success"], &trezor.Success{Message: proto.String("PONG")})
+		mocks <- mock
+		return mock, nil
+	})
+	defer bus.onOpen(nil)
+
+	c, err := Enumerate()[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-mocks
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = c.Reattach(ctx, ""); !errors.Is(err, ErrNoSerial) {
+		t.Errorf("expected ErrNoSerial, received %v", err)
+	}
+	if err = c.Reattach(ctx, "A1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// unplug, the old transport fails
+	bus.plug()
+	first.Close()
+	if _, _, err = c.CallMessage(c.Ping("PONG", false, false, false)); err == nil {
+		t.Fatal("expected the call to fail while the device is away")
+	}
+
+	// plug it back on another port, the client talks to the new transport
+	one.Path = "1-3:1.0"
+	bus.plug(one)
+	select {
+	case <-mocks:
+	case <-time.After(time.Second):
+		t.Fatal("device not reopened")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		str, _ := c.Call(c.Ping("PONG", false, false, false))
+		if str == "PONG" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected answer %q", str)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}